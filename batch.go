@@ -0,0 +1,292 @@
+package roadrunner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+
+	rrErrors "github.com/roadrunner-server/errors"
+	"github.com/roadrunner-server/goridge/v3/pkg/frame"
+	"github.com/roadrunner-server/pool/payload"
+	"github.com/roadrunner-server/pool/pool/static_pool"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// eventBatch collects ready events until batch.size of them are ready or
+// batch.wait passed since the first one. It is owned by the event loop and
+// guarded by pendingMu; batched events stay in pending until the batch is sent.
+type eventBatch struct {
+	size    int
+	wait    time.Duration
+	entries []batchEntry
+	timer   *time.Timer
+	// seq identifies the current batch, so a timer of a batch that was already
+	// sent does not send the next one early.
+	seq     uint64
+	flushCh chan uint64
+}
+
+// batchEntry is a batched event and its seq when it became ready. A later change
+// of the file restarts its debounce timer and leaves the entry stale.
+type batchEntry struct {
+	event *pendingFileEvent
+	seq   uint64
+}
+
+// batchItem is an event sent to one target of a batch.
+type batchItem struct {
+	event  *pendingFileEvent
+	dir    string
+	target *targetState
+}
+
+// batchAck is the result of one item in a structured batch response.
+type batchAck struct {
+	Path  string `json:"path"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+func newEventBatch(size int, wait time.Duration) *eventBatch {
+	return &eventBatch{size: size, wait: wait, flushCh: make(chan uint64, 16)}
+}
+
+// batchEvent adds a ready event to the batch and sends the batch once it is full.
+// The caller must hold pendingMu.
+func (p *Plugin) batchEvent(pending map[string]*pendingFileEvent, timers *eventTimers, pendingEvent *pendingFileEvent) {
+	b := p.batch
+	pendingEvent.held = false
+	b.entries = append(b.entries, batchEntry{event: pendingEvent, seq: pendingEvent.seq})
+	if len(b.entries) >= b.size {
+		p.flushBatch(pending, timers)
+		return
+	}
+	if len(b.entries) == 1 {
+		seq := b.seq
+		flushCh := b.flushCh
+		b.timer = time.AfterFunc(b.wait, func() {
+			flushCh <- seq
+		})
+	}
+}
+
+// flushBatch sends the batched events that are still current. The caller must
+// hold pendingMu; it is released while the targets run.
+func (p *Plugin) flushBatch(pending map[string]*pendingFileEvent, timers *eventTimers) {
+	entries := p.batch.reset()
+
+	events := make([]*pendingFileEvent, 0, len(entries))
+	for _, entry := range entries {
+		current, ok := pending[entry.event.event.Path]
+		if ok && current == entry.event && current.seq == entry.seq && !slices.Contains(events, current) {
+			events = append(events, current)
+		}
+	}
+	if len(events) == 0 {
+		return
+	}
+
+	dirs := make([]string, len(events))
+	for i, pendingEvent := range events {
+		dirs[i] = p.startDispatch(pending, pendingEvent)
+	}
+
+	p.pendingMu.Unlock()
+	p.deliverBatch(events, dirs)
+	p.pendingMu.Lock()
+
+	for i, pendingEvent := range events {
+		p.finishDispatch(pending, timers, pendingEvent, dirs[i])
+	}
+}
+
+// stopBatch discards the batch when the event loop stops. The caller must hold pendingMu.
+func (p *Plugin) stopBatch() {
+	if p.batch != nil {
+		p.batch.reset()
+	}
+}
+
+// reset empties the batch and returns its entries.
+func (b *eventBatch) reset() []batchEntry {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.seq++
+	entries := b.entries
+	b.entries = nil
+	return entries
+}
+
+// deliverBatch sends one payload per target with every event that still needs
+// the target, all targets at the same time.
+func (p *Plugin) deliverBatch(events []*pendingFileEvent, dirs []string) {
+	var names []string
+	items := make(map[string][]batchItem)
+	for i, pendingEvent := range events {
+		for _, target := range pendingEvent.targets {
+			if target.done {
+				continue
+			}
+			if _, ok := items[target.name]; !ok {
+				names = append(names, target.name)
+			}
+			items[target.name] = append(items[target.name], batchItem{event: pendingEvent, dir: dirs[i], target: target})
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, name := range names {
+		wg.Go(func() {
+			errs := p.dispatchBatch(name, items[name])
+			for i, item := range items[name] {
+				p.settleTarget(item.dir, item.target, errs[i])
+			}
+		})
+	}
+	wg.Wait()
+}
+
+// dispatchBatch sends the items as one JSON array to the target and returns the
+// outcome of every item. The batch span links the spans of the batched events.
+func (p *Plugin) dispatchBatch(target string, items []batchItem) []error {
+	start := time.Now().UTC()
+
+	details := make([]map[string]interface{}, len(items))
+	links := make([]trace.Link, 0, len(items))
+	for i, item := range items {
+		done := p.inFlight.start(item.event.event, item.target.attempt+1, start)
+		defer done()
+		details[i] = newEventDetails(item.dir, item.event.event)
+		if item.event.ctx != nil {
+			links = append(links, trace.LinkFromContext(item.event.ctx))
+		}
+	}
+	p.metrics.AddInFlight(int64(len(items)))
+	defer p.metrics.AddInFlight(-int64(len(items)))
+
+	attrs := []attribute.KeyValue{attribute.String("file_watch.target", target), attribute.Int("file_watch.batch_size", len(items))}
+	ctx, span := tracer().Start(context.Background(), spanBatch, trace.WithLinks(links...), trace.WithAttributes(attrs...))
+	for _, item := range items {
+		if item.event.span != nil {
+			item.event.span.AddEvent("batch dispatched", trace.WithAttributes(attrs...))
+		}
+	}
+
+	body, err := json.Marshal(details)
+	if err != nil {
+		endSpan(span, err)
+		return batchResults(items, nil, err)
+	}
+	pld := payload.Payload{
+		Body:  body,
+		Codec: frame.CodecRaw,
+	}
+
+	execCtx, execSpan := tracer().Start(ctx, spanWorkerExec)
+	pld.Context = traceContext(execCtx)
+
+	execStart := time.Now()
+	response, execErr := p.executePayload(target, &pld, p.cfg.BatchTimeout(target, len(items)))
+	p.metrics.ObserveWorkerExec(time.Since(execStart))
+	endSpan(execSpan, execErr)
+	endSpan(span, execErr)
+
+	errs := batchResults(items, response, execErr)
+	for i, item := range items {
+		p.recordDispatch(item.dir, item.event.event, target, item.target.attempt+1, start, errs[i])
+	}
+	return errs
+}
+
+// batchResults returns the outcome of every item. A failed batch fails every item;
+// a structured response acknowledges items by path and any other response
+// acknowledges all of them.
+func batchResults(items []batchItem, response []byte, execErr error) []error {
+	errs := make([]error, len(items))
+	if execErr == nil {
+		var acks map[string]batchAck
+		acks, execErr = parseBatchAcks(response)
+		if execErr == nil && acks == nil {
+			return errs
+		}
+		if execErr == nil {
+			for i, item := range items {
+				path := item.event.event.Path
+				ack, ok := acks[path]
+				switch {
+				case !ok:
+					errs[i] = &dispatchFailure{reason: failureUnexpectedResponse, err: rrErrors.Errorf("batch response has no result for %s", path)}
+				case !ack.OK && ack.Error != "":
+					errs[i] = &dispatchFailure{reason: failureWorkerError, err: rrErrors.Errorf("worker failed %s: %s", path, ack.Error)}
+				case !ack.OK:
+					errs[i] = &dispatchFailure{reason: failureWorkerError, err: rrErrors.Errorf("worker failed %s", path)}
+				}
+			}
+			return errs
+		}
+	}
+	for i := range errs {
+		errs[i] = execErr
+	}
+	return errs
+}
+
+// parseBatchAcks returns the acknowledged items of a structured batch response by
+// path, or nil when the response is not a JSON array.
+func parseBatchAcks(response []byte) (map[string]batchAck, error) {
+	response = bytes.TrimSpace(response)
+	if len(response) == 0 || response[0] != '[' {
+		return nil, nil
+	}
+	var list []batchAck
+	if err := json.Unmarshal(response, &list); err != nil {
+		return nil, &dispatchFailure{reason: failureUnexpectedResponse, err: rrErrors.Errorf("invalid batch response: %v", err)}
+	}
+	acks := make(map[string]batchAck, len(list))
+	for _, ack := range list {
+		acks[ack.Path] = ack
+	}
+	return acks, nil
+}
+
+// isBatchPayload reports whether the payload is a batch: single events are JSON
+// objects, batches JSON arrays.
+func isBatchPayload(pld *payload.Payload) bool {
+	return len(pld.Body) > 0 && pld.Body[0] == '['
+}
+
+// batchAcksBody returns a worker response that acknowledges batch items, that is
+// a JSON array instead of OK or ERROR.
+func batchAcksBody(response workerExecutionResponse) ([]byte, bool) {
+	if response.Error() != nil {
+		return nil, false
+	}
+	body := bytes.TrimSpace(response.Body())
+	if len(body) == 0 || body[0] != '[' {
+		return nil, false
+	}
+	return body, true
+}
+
+// receiveBatchResponse waits for the worker response to a batch. Besides OK and
+// ERROR for the whole batch, workers can answer with per item acknowledgements.
+func receiveBatchResponse(ctx context.Context, responses <-chan *static_pool.PExec) ([]byte, error) {
+	select {
+	case <-ctx.Done():
+		return nil, rrErrors.E(rrErrors.Op("file_watch_batch_response"), rrErrors.ExecTTL, ctx.Err())
+	case response, ok := <-responses:
+		if !ok || response == nil {
+			return nil, &dispatchFailure{reason: failureNoResponse, err: rrErrors.Str("worker returned no response")}
+		}
+		if acks, ok := batchAcksBody(response); ok {
+			return acks, nil
+		}
+		return nil, classifyWorkerExecutionResponse(response)
+	}
+}
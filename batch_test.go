@@ -0,0 +1,227 @@
+package roadrunner
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/radovskyb/watcher"
+	"go.uber.org/zap"
+)
+
+func TestBatchResultsAcknowledgeItemsByPath(t *testing.T) {
+	items := []batchItem{
+		{event: &pendingFileEvent{event: watcher.Event{Path: "/lmx/results/1.game"}}},
+		{event: &pendingFileEvent{event: watcher.Event{Path: "/lmx/results/2.game"}}},
+		{event: &pendingFileEvent{event: watcher.Event{Path: "/lmx/results/3.game"}}},
+	}
+
+	errs := batchResults(items, []byte(`[{"path":"/lmx/results/1.game","ok":true},{"path":"/lmx/results/2.game","ok":false,"error":"corrupt result"}]`), nil)
+	if errs[0] != nil {
+		t.Fatalf("expected the acknowledged item to succeed, got %v", errs[0])
+	}
+	if reason := failureReason(errs[1]); reason != failureWorkerError {
+		t.Fatalf("expected the failed item to be a worker error, got %s: %v", reason, errs[1])
+	}
+	if reason := failureReason(errs[2]); reason != failureUnexpectedResponse {
+		t.Fatalf("expected the missing item to be an unexpected response, got %s: %v", reason, errs[2])
+	}
+
+	for _, err := range batchResults(items, nil, nil) {
+		if err != nil {
+			t.Fatalf("expected a plain response to acknowledge every item, got %v", err)
+		}
+	}
+
+	failed := errors.New("worker failed")
+	for _, err := range batchResults(items, nil, failed) {
+		if !errors.Is(err, failed) {
+			t.Fatalf("expected a failed batch to fail every item, got %v", err)
+		}
+	}
+
+	for _, err := range batchResults(items, []byte(`[{"path":`), nil) {
+		if reason := failureReason(err); reason != failureUnexpectedResponse {
+			t.Fatalf("expected an invalid response to be unexpected, got %s: %v", reason, err)
+		}
+	}
+}
+
+func TestFlushBatchRetriesOnlyFailedItems(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "1.game")
+	second := filepath.Join(dir, "2.game")
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		var events []map[string]interface{}
+		if err := json.Unmarshal(body, &events); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		acks := make([]batchAck, len(events))
+		for i, event := range events {
+			path := event["path"].(string)
+			acks[i] = batchAck{Path: path, OK: path == first}
+			if !acks[i].OK {
+				acks[i].Error = "corrupt result"
+			}
+		}
+		_ = json.NewEncoder(w).Encode(acks)
+	}))
+	defer server.Close()
+
+	cfg := &Config{
+		Dirs:         []string{dir},
+		MaxAttempts:  3,
+		RetryBackoff: "1h",
+		Output:       "importer",
+		Sinks:        map[string]*SinkConfig{"importer": {Type: OutputHTTP, URL: server.URL}},
+		Batch:        &BatchConfig{Size: 2, Wait: "1h"},
+	}
+	cfg.InitDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected batch config to be valid: %v", err)
+	}
+	p := &Plugin{
+		cfg:   cfg,
+		log:   zap.NewNop(),
+		sinks: map[string]Sink{"importer": newTestHTTPSink(t, cfg.Sinks["importer"])},
+		batch: newEventBatch(cfg.Batch.Size, time.Hour),
+	}
+	p.metrics = newStatsExporter(p, nil)
+	pending := make(map[string]*pendingFileEvent)
+	timers := newEventTimers()
+
+	p.pendingMu.Lock()
+	defer p.pendingMu.Unlock()
+	for _, path := range []string{first, second} {
+		if err := os.WriteFile(path, []byte("content"), 0644); err != nil {
+			t.Fatalf("failed to write result file: %v", err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("failed to stat result file: %v", err)
+		}
+		p.dispatchPendingEvent(pending, timers, queueEvent(pending, watcher.Event{Path: path, Op: watcher.Create, FileInfo: info}))
+	}
+
+	if calls.Load() != 1 {
+		t.Fatalf("expected a full batch to be sent once, got %d requests", calls.Load())
+	}
+	if _, ok := pending[first]; ok {
+		t.Fatal("expected the acknowledged event to be done")
+	}
+	retry, ok := pending[second]
+	if !ok {
+		t.Fatal("expected the failed event to be retried")
+	}
+	if retry.attempt != 1 {
+		t.Fatalf("expected the failed event to be on its second attempt, got %d", retry.attempt+1)
+	}
+	stopPendingEvents(pending)
+}
+
+func TestSlowBatchGetsTheDeadlineOfEveryEvent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		// Slower than the sink timeout for one event, faster than for three.
+		time.Sleep(250 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	cfg := &Config{
+		Output: "importer",
+		Sinks:  map[string]*SinkConfig{"importer": {Type: OutputHTTP, URL: server.URL, Timeout: "100ms"}},
+		Batch:  &BatchConfig{Size: 3},
+	}
+	cfg.InitDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected batch config to be valid: %v", err)
+	}
+	p := &Plugin{cfg: cfg, log: zap.NewNop(), sinks: map[string]Sink{"importer": newTestHTTPSink(t, cfg.Sinks["importer"])}}
+	p.metrics = newStatsExporter(p, nil)
+
+	var items []batchItem
+	for _, name := range []string{"1.game", "2.game", "3.game"} {
+		path := filepath.Join("/lmx/results", name)
+		event := &pendingFileEvent{event: watcher.Event{Path: path, Op: watcher.Create, FileInfo: recordedFileInfo{queueRecord{Path: path}}}}
+		items = append(items, batchItem{event: event, dir: "/lmx/results", target: &targetState{name: "importer"}})
+	}
+	for i, err := range p.dispatchBatch("importer", items) {
+		if err != nil {
+			t.Fatalf("expected item %d of the slow batch to succeed, got %v", i, err)
+		}
+	}
+
+	cfg.Batch.Timeout = "50ms"
+	if timeout := cfg.BatchTimeout("importer", len(items)); timeout != 50*time.Millisecond {
+		t.Fatalf("expected batch.timeout to set the batch deadline, got %s", timeout)
+	}
+}
+
+func TestFlushBatchSkipsChangedEvents(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	cfg := &Config{
+		Output: "importer",
+		Sinks:  map[string]*SinkConfig{"importer": {Type: OutputHTTP, URL: server.URL}},
+		Batch:  &BatchConfig{Size: 10, Wait: "1h"},
+	}
+	cfg.InitDefaults()
+	p := &Plugin{
+		cfg:   cfg,
+		log:   zap.NewNop(),
+		sinks: map[string]Sink{"importer": newTestHTTPSink(t, cfg.Sinks["importer"])},
+		batch: newEventBatch(cfg.Batch.Size, time.Hour),
+	}
+	p.metrics = newStatsExporter(p, nil)
+	pending := make(map[string]*pendingFileEvent)
+	timers := newEventTimers()
+
+	p.pendingMu.Lock()
+	defer p.pendingMu.Unlock()
+	event := watcher.Event{Path: "/lmx/results/1.game", Op: watcher.Write}
+	p.dispatchPendingEvent(pending, timers, queueEvent(pending, event))
+	// The file changes again before the batch is sent.
+	queueEvent(pending, event)
+	p.flushBatch(pending, timers)
+
+	if calls.Load() != 0 {
+		t.Fatalf("expected the changed event to wait for its new debounce, got %d requests", calls.Load())
+	}
+	if _, ok := pending[event.Path]; !ok {
+		t.Fatal("expected the changed event to stay pending")
+	}
+	stopPendingEvents(pending)
+}
+
+func TestConfigRejectsInvalidBatch(t *testing.T) {
+	for name, batch := range map[string]*BatchConfig{
+		"negative size": {Size: -1},
+		"invalid wait":  {Wait: "soon"},
+		"negative wait": {Wait: "-1s"},
+		"bad timeout":   {Timeout: "-1s"},
+	} {
+		cfg := &Config{Batch: batch}
+		cfg.InitDefaults()
+
+		if err := cfg.Validate(); err == nil {
+			t.Fatalf("expected %s to be rejected", name)
+		}
+	}
+}
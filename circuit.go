@@ -0,0 +1,200 @@
+package roadrunner
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// circuitProbeWait is how long events wait while the probe of a half-open breaker runs.
+const circuitProbeWait = time.Second
+
+// circuitState is the state of a circuit breaker, exported as the circuit_state gauge.
+type circuitState int
+
+const (
+	// circuitClosed lets every dispatch through.
+	circuitClosed circuitState = iota
+	// circuitHalfOpen lets one probe through after open_for.
+	circuitHalfOpen
+	// circuitOpen holds every event until open_for has passed.
+	circuitOpen
+)
+
+func (s circuitState) String() string {
+	switch s {
+	case circuitHalfOpen:
+		return "half_open"
+	case circuitOpen:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker stops dispatches to a sink after failures consecutive failures.
+// Once openFor passed, one probe is let through: its success closes the breaker,
+// its failure opens it again. The event loop asks it before dispatching, the
+// dispatches record their outcome.
+type circuitBreaker struct {
+	mu       sync.Mutex
+	failures int
+	openFor  time.Duration
+
+	state       circuitState
+	consecutive int
+	openedAt    time.Time
+	// probeAt is when the probe of a half-open breaker was let through. A probe
+	// whose event was never dispatched is replaced after openFor.
+	probeAt time.Time
+}
+
+// newCircuitBreakers returns a breaker for every sink events are delivered to, or
+// nil without circuit_breaker. The configuration is already validated.
+func newCircuitBreakers(cfg *Config) map[string]*circuitBreaker {
+	if cfg.CircuitBreaker == nil {
+		return nil
+	}
+	openFor, _ := cfg.CircuitBreaker.OpenForDuration()
+	breakers := make(map[string]*circuitBreaker)
+	for _, name := range cfg.SinkNames() {
+		breakers[name] = &circuitBreaker{failures: cfg.CircuitBreaker.Failures, openFor: openFor}
+	}
+	return breakers
+}
+
+// wait returns how long a dispatch has to wait for the breaker, 0 when it may go
+// through. A nil breaker never waits.
+func (b *circuitBreaker) wait(now time.Time) time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		return max(0, b.openedAt.Add(b.openFor).Sub(now))
+	case circuitHalfOpen:
+		if now.Sub(b.probeAt) < b.openFor {
+			return circuitProbeWait
+		}
+	}
+	return 0
+}
+
+// allow lets a dispatch through, turning an open breaker whose open_for passed
+// into a half-open one with this dispatch as its probe. It reports whether the
+// state changed.
+func (b *circuitBreaker) allow(now time.Time) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == circuitClosed {
+		return false
+	}
+	b.probeAt = now
+	changed := b.state != circuitHalfOpen
+	b.state = circuitHalfOpen
+	return changed
+}
+
+// record counts the outcome of a dispatch and reports whether the state changed.
+func (b *circuitBreaker) record(now time.Time, failed bool) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	previous := b.state
+	if !failed {
+		b.consecutive = 0
+		b.state = circuitClosed
+		return previous != b.state
+	}
+
+	b.consecutive++
+	if b.state == circuitHalfOpen || (b.state == circuitClosed && b.consecutive >= b.failures) {
+		b.state = circuitOpen
+		b.openedAt = now
+	}
+	return previous != b.state
+}
+
+// current returns the state of the breaker.
+func (b *circuitBreaker) current() circuitState {
+	if b == nil {
+		return circuitClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// breakEvent holds an event in pending while the breaker of a target it still
+// needs is open, and lets it through as the probe of breakers that may half-open.
+// The caller must hold pendingMu.
+func (p *Plugin) breakEvent(timers *eventTimers, pendingEvent *pendingFileEvent) bool {
+	if p.breakers == nil {
+		return false
+	}
+
+	var names []string
+	if pendingEvent.targets != nil {
+		for _, target := range pendingEvent.targets {
+			if !target.done {
+				names = append(names, target.name)
+			}
+		}
+	} else {
+		watch := p.cfg.Watch(p.watchedDirectoryForEvent(pendingEvent.event.Path))
+		names = watch.TargetNames(p.cfg.Output)
+	}
+
+	now := time.Now()
+	var delay time.Duration
+	for _, name := range names {
+		delay = max(delay, p.breakers[name].wait(now))
+	}
+	if delay > 0 {
+		pendingEvent.held = false
+		pendingEvent.schedule(timers, delay)
+		p.log.Debug("circuit breaker open, event held", zap.String("path", pendingEvent.event.Path), zap.Duration("delay", delay))
+		return true
+	}
+
+	for _, name := range names {
+		if p.breakers[name].allow(now) {
+			p.circuitChanged(name)
+		}
+	}
+	return false
+}
+
+// recordCircuit counts the outcome of a delivery to target. Permanent failures are
+// problems of the event, not of the sink, and count as successful deliveries.
+func (p *Plugin) recordCircuit(target string, err error) {
+	if p.breakers[target].record(time.Now(), err != nil && !permanentFailure(err)) {
+		p.circuitChanged(target)
+	}
+}
+
+// circuitChanged reports a state change of the breaker of target.
+func (p *Plugin) circuitChanged(target string) {
+	state := p.breakers[target].current()
+	p.metrics.SetCircuitState(target, state)
+	switch state {
+	case circuitOpen:
+		p.metrics.CountCircuitOpened(target)
+		p.log.Warn("circuit breaker opened, events are held", zap.String("target", target), zap.Duration("open_for", p.breakers[target].openFor))
+	case circuitHalfOpen:
+		p.log.Info("circuit breaker half-open, probing", zap.String("target", target))
+	default:
+		p.log.Info("circuit breaker closed", zap.String("target", target))
+	}
+}
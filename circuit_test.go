@@ -0,0 +1,161 @@
+package roadrunner
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/radovskyb/watcher"
+	"go.uber.org/zap"
+)
+
+func TestCircuitBreakerOpensAndProbes(t *testing.T) {
+	now := time.Now()
+	breaker := &circuitBreaker{failures: 2, openFor: time.Minute}
+
+	if breaker.record(now, true) || breaker.current() != circuitClosed {
+		t.Fatal("expected the breaker to stay closed below the failure threshold")
+	}
+	if !breaker.record(now, true) || breaker.current() != circuitOpen {
+		t.Fatal("expected the breaker to open at the failure threshold")
+	}
+	if wait := breaker.wait(now); wait != time.Minute {
+		t.Fatalf("expected an open breaker to hold events for open_for, got %s", wait)
+	}
+
+	later := now.Add(time.Minute)
+	if wait := breaker.wait(later); wait != 0 {
+		t.Fatalf("expected a probe after open_for, got a wait of %s", wait)
+	}
+	if !breaker.allow(later) || breaker.current() != circuitHalfOpen {
+		t.Fatal("expected the probe to half-open the breaker")
+	}
+	if wait := breaker.wait(later); wait != circuitProbeWait {
+		t.Fatalf("expected other events to wait for the probe, got %s", wait)
+	}
+	if !breaker.record(later, true) || breaker.current() != circuitOpen {
+		t.Fatal("expected a failed probe to open the breaker again")
+	}
+
+	latest := later.Add(time.Minute)
+	breaker.allow(latest)
+	if !breaker.record(latest, false) || breaker.current() != circuitClosed {
+		t.Fatal("expected a successful probe to close the breaker")
+	}
+
+	var disabled *circuitBreaker
+	if disabled.wait(now) != 0 || disabled.allow(now) || disabled.record(now, true) {
+		t.Fatal("expected a nil breaker to let everything through")
+	}
+}
+
+func TestCircuitBreakerHoldsEventsWhileOpen(t *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "result.game")
+	if err := os.WriteFile(path, []byte("content"), 0644); err != nil {
+		t.Fatalf("failed to write result file: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat result file: %v", err)
+	}
+
+	cfg := &Config{
+		Dirs:           []string{dir},
+		MaxAttempts:    3,
+		RetryBackoff:   "0s",
+		Output:         "importer",
+		Sinks:          map[string]*SinkConfig{"importer": {Type: OutputHTTP, URL: server.URL}},
+		CircuitBreaker: &CircuitBreakerConfig{Failures: 1, OpenFor: "1h"},
+	}
+	cfg.InitDefaults()
+	if err = cfg.Validate(); err != nil {
+		t.Fatalf("expected circuit breaker config to be valid: %v", err)
+	}
+	p := &Plugin{
+		cfg:         cfg,
+		log:         zap.NewNop(),
+		sinks:       map[string]Sink{"importer": newTestHTTPSink(t, cfg.Sinks["importer"])},
+		breakers:    newCircuitBreakers(cfg),
+		withoutPool: true,
+	}
+	p.metrics = newStatsExporter(p, nil)
+	pending := make(map[string]*pendingFileEvent)
+	timers := newEventTimers()
+
+	p.pendingMu.Lock()
+	p.dispatchPendingEvent(pending, timers, queueEvent(pending, watcher.Event{Path: path, Op: watcher.Create, FileInfo: info}))
+	retry, ok := pending[path]
+	if !ok || p.breakers["importer"].current() != circuitOpen {
+		p.pendingMu.Unlock()
+		t.Fatal("expected the failed dispatch to open the breaker and be retried")
+	}
+
+	// The retry is due, but the breaker holds it without using an attempt.
+	p.dispatchPendingEvent(pending, timers, retry)
+	if calls.Load() != 1 || retry.attempt != 1 {
+		p.pendingMu.Unlock()
+		t.Fatalf("expected the retry to be held, got %d requests at attempt %d", calls.Load(), retry.attempt)
+	}
+	if wait := time.Until(retry.fireAt); wait < 59*time.Minute {
+		p.pendingMu.Unlock()
+		t.Fatalf("expected the retry to wait for open_for, got %s", wait)
+	}
+	p.pendingMu.Unlock()
+
+	report := p.health(false)
+	var reported bool
+	for _, reason := range report.Reasons {
+		if reason.Check == healthCheckCircuit && reason.Target == "importer" && reason.Degraded {
+			reported = true
+		}
+	}
+	if !reported {
+		t.Fatalf("expected the open breaker in the health report, got %+v", report.Reasons)
+	}
+
+	// The importer is back once open_for passed; the retry probes and closes the breaker.
+	down.Store(false)
+	p.breakers["importer"].openedAt = time.Now().Add(-time.Hour)
+	p.pendingMu.Lock()
+	defer p.pendingMu.Unlock()
+	p.dispatchPendingEvent(pending, timers, retry)
+	if calls.Load() != 2 || len(pending) != 0 {
+		t.Fatalf("expected the probe to deliver the event, got %d requests and %d pending", calls.Load(), len(pending))
+	}
+	if state := p.breakers["importer"].current(); state != circuitClosed {
+		t.Fatalf("expected the successful probe to close the breaker, got %s", state)
+	}
+}
+
+func TestConfigRejectsInvalidCircuitBreaker(t *testing.T) {
+	for name, breaker := range map[string]*CircuitBreakerConfig{
+		"negative failures": {Failures: -1},
+		"invalid open_for":  {OpenFor: "a while"},
+		"zero open_for":     {OpenFor: "0s"},
+	} {
+		cfg := &Config{Dir: t.TempDir(), CircuitBreaker: breaker}
+		cfg.InitDefaults()
+
+		if err := cfg.Validate(); err == nil {
+			t.Fatalf("expected %s to be rejected", name)
+		}
+	}
+}
@@ -2,12 +2,61 @@ package roadrunner
 
 import (
 	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
 	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	poolImpl "github.com/roadrunner-server/pool/pool"
 )
 
+const (
+	// OutputPool executes events on the plugin's own worker pool.
+	OutputPool = "pool"
+	// OutputJobs pushes events as jobs into a pipeline of RoadRunner's jobs plugin.
+	OutputJobs = "jobs"
+	// OutputHTTP posts events as JSON to a webhook.
+	OutputHTTP = "http"
+	// OutputExec runs a local command per event with the event JSON on stdin.
+	OutputExec = "exec"
+	// OutputSocket writes events as JSON lines to a Unix socket.
+	OutputSocket = "socket"
+
+	// SuccessAll treats a fanned out event as delivered when every target succeeded.
+	SuccessAll = "all"
+	// SuccessAny treats a fanned out event as delivered when one target succeeded.
+	SuccessAny = "any"
+	// SuccessPrimary treats a fanned out event as delivered when the first target
+	// succeeded; the other targets are best effort.
+	SuccessPrimary = "primary"
+
+	// OrderPath serializes the events of each file.
+	OrderPath = "path"
+	// OrderDir serializes the events of each watch directory.
+	OrderDir = "dir"
+	// OrderPattern serializes events whose file names share the first capture group
+	// of ordering.pattern.
+	OrderPattern = "pattern"
+
+	// OverflowDropOldest discards the oldest buffered event to make room for a new one.
+	OverflowDropOldest = "drop_oldest"
+	// OverflowDropNewest discards the new event and keeps the buffered ones.
+	OverflowDropNewest = "drop_newest"
+	// OverflowBlock stops reading file events until there is room for the new one.
+	OverflowBlock = "block"
+	// OverflowSpill writes new events to disk until there is room for them.
+	OverflowSpill = "spill"
+)
+
+// defaultDispatchTimeout is the deadline of a dispatch to a sink without a timeout.
+const defaultDispatchTimeout = 10 * time.Second
+
 type Config struct {
 	// Pool configures roadrunner workers pool.
 	Pool   *poolImpl.Config `mapstructure:"pool"`
@@ -17,6 +66,357 @@ type Config struct {
 	// Debounce delays worker dispatch for repeated events on the same path until the file is quiet.
 	// Configure it as a Go duration string, for example "500ms", "1s", or "0s" to disable coalescing.
 	Debounce string `mapstructure:"debounce"`
+	// StateFile stores watch directories added or removed through RPC with persist enabled.
+	// Persisted changes are applied on top of dir/dirs on the next start. Empty disables persistence.
+	StateFile string `mapstructure:"state_file"`
+	// DirCheckInterval controls how often missing watch directories are checked again, so directories
+	// that appear after startup (for example a network share) are picked up. "0s" disables the check.
+	DirCheckInterval string `mapstructure:"dir_check_interval"`
+	// PauseBuffer limits how many distinct files are held while dispatch is paused through RPC.
+	PauseBuffer int `mapstructure:"pause_buffer"`
+	// PauseOverflow selects which event is dropped when the pause buffer is full: "drop_oldest" or "drop_newest".
+	PauseOverflow string `mapstructure:"pause_overflow"`
+	// PendingCapacity limits how many distinct files wait in the event loop for their
+	// debounce window, a retry or dispatch. 0 does not limit them.
+	PendingCapacity int `mapstructure:"pending_capacity"`
+	// PendingOverflow selects what happens to a new file when the pending queue is full:
+	// "block", "drop_oldest" or "spill".
+	PendingOverflow string `mapstructure:"pending_overflow"`
+	// SpillDir keeps the events spilled with pending_overflow spill.
+	SpillDir string `mapstructure:"spill_dir"`
+	// MaxAttempts is how many times an event is dispatched before it is given up. 1 disables retries.
+	MaxAttempts int `mapstructure:"max_attempts"`
+	// RetryBackoff is the delay before the first retry of a failed dispatch. It doubles with every attempt.
+	RetryBackoff string `mapstructure:"retry_backoff"`
+	// LatencyBuckets are the histogram buckets in seconds for the latency metrics.
+	LatencyBuckets []float64 `mapstructure:"latency_buckets"`
+	// LegacyMetrics additionally exports the unlabelled events, jobs_ok and jobs_err gauges
+	// for dashboards built before the labelled counters were introduced.
+	LegacyMetrics bool `mapstructure:"legacy_metrics"`
+	// Watches configures individual watch directories. Their directories are watched in
+	// addition to dir/dirs.
+	Watches []WatchConfig `mapstructure:"watches"`
+	// DegradedStatusCode is reported by Status and Ready while the plugin works but is degraded,
+	// for example when a watch directory has gone stale. It defaults to 207, which keeps
+	// probes passing but differs from the 503 of an unavailable plugin.
+	DegradedStatusCode int `mapstructure:"degraded_status_code"`
+	// ErrorRateWindow is the sliding window over which the dispatch error rate is measured
+	// for health checks. "0s" disables the error rate check.
+	ErrorRateWindow string `mapstructure:"error_rate_window"`
+	// MaxErrorRate is the fraction of failed dispatches inside the window above which the
+	// plugin is reported as degraded.
+	MaxErrorRate float64 `mapstructure:"max_error_rate"`
+	// ErrorRateMinDispatches is how many dispatches the window needs before the error rate is judged.
+	ErrorRateMinDispatches int `mapstructure:"error_rate_min_dispatches"`
+	// Output is the sink events are sent to unless their watch selects another one:
+	// "pool", "jobs" or the name of an entry of Sinks.
+	Output string `mapstructure:"output"`
+	// Jobs configures the jobs pipeline events are pushed to by the "jobs" sink.
+	Jobs *JobsConfig `mapstructure:"jobs"`
+	// Sinks defines named sinks that Output and watches entries can select.
+	Sinks map[string]*SinkConfig `mapstructure:"sinks"`
+	// Batch sends ready events together in one payload. Nil dispatches every event on its own.
+	Batch *BatchConfig `mapstructure:"batch"`
+	// Rate limits dispatches of all watches, for example "5/s" or "100/m". Empty
+	// disables the global limit.
+	Rate string `mapstructure:"rate"`
+	// Burst is how many events may be dispatched at once above Rate.
+	Burst int `mapstructure:"burst"`
+	// QueueDir keeps a write-ahead log of detected events that were not acknowledged
+	// yet, so they are dispatched again after a restart. Empty keeps events in memory only.
+	QueueDir string `mapstructure:"queue_dir"`
+	// CircuitBreaker holds events for a sink after consecutive failed dispatches to it.
+	// Nil disables the breakers.
+	CircuitBreaker *CircuitBreakerConfig `mapstructure:"circuit_breaker"`
+	// Ordering dispatches events in parallel while events sharing an ordering key
+	// stay in order. Nil dispatches one event at a time.
+	Ordering *OrderingConfig `mapstructure:"ordering"`
+}
+
+// CircuitBreakerConfig configures the circuit breaker of every sink.
+type CircuitBreakerConfig struct {
+	// Failures is how many consecutive failed dispatches to a sink open its breaker.
+	Failures int `mapstructure:"failures"`
+	// OpenFor is how long an open breaker holds events before one probe is let through.
+	OpenFor string `mapstructure:"open_for"`
+}
+
+func (c *CircuitBreakerConfig) OpenForDuration() (time.Duration, error) {
+	openFor, err := time.ParseDuration(c.OpenFor)
+	if err != nil {
+		return 0, err
+	}
+	if openFor <= 0 {
+		return 0, errors.New("circuit_breaker.open_for must be positive")
+	}
+	return openFor, nil
+}
+
+// OrderingConfig configures parallel dispatch with ordering keys.
+type OrderingConfig struct {
+	// Key selects the ordering key of an event: "path", "dir" or "pattern".
+	Key string `mapstructure:"key"`
+	// Pattern is matched against the file name with key "pattern". Its first capture
+	// group is the ordering key, for example `^(game\d+)\.` for game123.xml and
+	// game123.scores. File names that do not match are ordered by path.
+	Pattern string `mapstructure:"pattern"`
+	// Parallelism is the most ordering keys dispatched at the same time.
+	Parallelism int `mapstructure:"parallelism"`
+}
+
+// KeyPattern compiles Pattern. It returns nil unless Key is "pattern".
+func (o *OrderingConfig) KeyPattern() (*regexp.Regexp, error) {
+	if o.Key != OrderPattern {
+		if o.Pattern != "" {
+			return nil, errors.New("ordering.pattern requires ordering.key pattern")
+		}
+		return nil, nil
+	}
+	pattern, err := regexp.Compile(o.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("ordering.pattern: %w", err)
+	}
+	if pattern.NumSubexp() < 1 {
+		return nil, errors.New("ordering.pattern needs a capture group")
+	}
+	return pattern, nil
+}
+
+// BatchConfig configures batch dispatch.
+type BatchConfig struct {
+	// Size is the most events sent in one batch.
+	Size int `mapstructure:"size"`
+	// Wait is how long the first ready event waits for more before the batch is sent.
+	Wait string `mapstructure:"wait"`
+	// Timeout is the dispatch deadline of a batch. Empty gives every event of the
+	// batch the dispatch deadline of its sink.
+	Timeout string `mapstructure:"timeout"`
+}
+
+func (b *BatchConfig) WaitDuration() (time.Duration, error) {
+	wait, err := time.ParseDuration(b.Wait)
+	if err != nil {
+		return 0, err
+	}
+	if wait < 0 {
+		return 0, errors.New("batch.wait must not be negative")
+	}
+	return wait, nil
+}
+
+func (b *BatchConfig) TimeoutDuration() (time.Duration, error) {
+	if b.Timeout == "" {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(b.Timeout)
+	if err != nil {
+		return 0, err
+	}
+	if timeout < 0 {
+		return 0, errors.New("batch.timeout must not be negative")
+	}
+	return timeout, nil
+}
+
+// BatchTimeout returns the deadline of a batch of size events to the named sink:
+// batch.timeout, or the dispatch deadline of the sink for every event.
+func (cfg *Config) BatchTimeout(name string, size int) time.Duration {
+	if timeout, err := cfg.Batch.TimeoutDuration(); err == nil && timeout > 0 {
+		return timeout
+	}
+	return cfg.DispatchTimeout(name) * time.Duration(max(size, 1))
+}
+
+// SinkConfig configures a named sink.
+type SinkConfig struct {
+	// Type is pool, jobs, http, exec or socket.
+	Type string `mapstructure:"type"`
+	// Jobs configures the pipeline of a jobs sink.
+	Jobs *JobsConfig `mapstructure:"jobs"`
+	// URL is the webhook an http sink posts events to.
+	URL string `mapstructure:"url"`
+	// SecretEnv names the environment variable with the shared secret an http sink
+	// signs requests with using HMAC-SHA256. Empty sends unsigned requests.
+	SecretEnv string `mapstructure:"secret_env"`
+	// Headers are added to every request of an http sink.
+	Headers map[string]string `mapstructure:"headers"`
+	// Timeout is the dispatch deadline of an http sink. Empty uses the default
+	// dispatch deadline.
+	Timeout string `mapstructure:"timeout"`
+	// TLS configures trusted CAs and the client certificate of an http sink.
+	TLS *SinkTLSConfig `mapstructure:"tls"`
+	// Command is the program and arguments an exec sink runs for every event.
+	Command []string `mapstructure:"command"`
+	// Socket is the path of the Unix socket a socket sink writes events to.
+	Socket string `mapstructure:"socket"`
+}
+
+// SinkTLSConfig holds the TLS settings of an http sink.
+type SinkTLSConfig struct {
+	// CA is a PEM file with the CAs trusted instead of the system roots.
+	CA string `mapstructure:"ca"`
+	// Cert and Key are PEM files of the client certificate for mutual TLS.
+	Cert string `mapstructure:"cert"`
+	Key  string `mapstructure:"key"`
+	// ServerName overrides the host name the server certificate is verified against.
+	ServerName string `mapstructure:"server_name"`
+	// InsecureSkipVerify disables server certificate verification.
+	InsecureSkipVerify bool `mapstructure:"insecure_skip_verify"`
+}
+
+func (s *SinkConfig) TimeoutDuration() (time.Duration, error) {
+	if s.Timeout == "" {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(s.Timeout)
+	if err != nil {
+		return 0, err
+	}
+	if timeout < 0 {
+		return 0, errors.New("timeout must not be negative")
+	}
+	return timeout, nil
+}
+
+func (s *SinkConfig) InitDefaults() {
+	if s.Type == OutputJobs {
+		if s.Jobs == nil {
+			s.Jobs = &JobsConfig{}
+		}
+		s.Jobs.InitDefaults()
+	}
+}
+
+func (s *SinkConfig) Validate() error {
+	switch s.Type {
+	case OutputPool:
+	case OutputJobs:
+		return s.Jobs.Validate()
+	case OutputHTTP:
+		u, err := url.Parse(s.URL)
+		if err != nil {
+			return err
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("url must be an http or https URL")
+		}
+		if _, err = s.TimeoutDuration(); err != nil {
+			return err
+		}
+		if s.SecretEnv != "" && os.Getenv(s.SecretEnv) == "" {
+			return fmt.Errorf("environment variable %s of secret_env is empty", s.SecretEnv)
+		}
+		if s.TLS != nil && (s.TLS.Cert == "") != (s.TLS.Key == "") {
+			return errors.New("tls.cert and tls.key must be set together")
+		}
+	case OutputExec:
+		if len(s.Command) == 0 || s.Command[0] == "" {
+			return errors.New("command is required")
+		}
+	case OutputSocket:
+		if s.Socket == "" {
+			return errors.New("socket is required")
+		}
+	default:
+		return errors.New("type must be pool, jobs, http, exec or socket")
+	}
+	return nil
+}
+
+// JobsConfig configures pushing events into a jobs pipeline.
+type JobsConfig struct {
+	// Pipeline is the jobs pipeline events are pushed to.
+	Pipeline string `mapstructure:"pipeline"`
+	// Name is the job name workers receive.
+	Name string `mapstructure:"name"`
+	// Priority of the pushed jobs; lower values are consumed first.
+	Priority int64 `mapstructure:"priority"`
+	// Delay in seconds before a pushed job is consumed.
+	Delay int64 `mapstructure:"delay"`
+	// AutoAck acknowledges jobs when they are received by a worker.
+	AutoAck bool `mapstructure:"auto_ack"`
+}
+
+func (j *JobsConfig) InitDefaults() {
+	if j.Name == "" {
+		j.Name = PluginName
+	}
+	if j.Priority == 0 {
+		j.Priority = 10
+	}
+}
+
+func (j *JobsConfig) Validate() error {
+	if j.Pipeline == "" {
+		return errors.New("jobs.pipeline is required")
+	}
+	if j.Delay < 0 {
+		return errors.New("jobs.delay must not be negative")
+	}
+	return nil
+}
+
+// WatchConfig holds settings for a single watch directory.
+type WatchConfig struct {
+	Dir string `mapstructure:"dir"`
+	// StaleAfter marks the directory as stale when no file event was received for this long.
+	// Empty or "0s" disables the check.
+	StaleAfter string `mapstructure:"stale_after"`
+	// ActiveHours limits the stale check to the hours files are expected, for example
+	// "mon-fri 14:00-23:00". Silence outside of them is not counted. Empty means always.
+	ActiveHours []string `mapstructure:"active_hours"`
+	// Timezone is the IANA time zone of ActiveHours. Empty uses the local time zone.
+	Timezone string `mapstructure:"timezone"`
+	// Sink selects where events of this directory are sent, like Output. Empty uses Output.
+	Sink string `mapstructure:"sink"`
+	// Targets sends every event of this directory to several sinks, each with its own
+	// retries. It replaces Sink.
+	Targets []string `mapstructure:"targets"`
+	// Success decides when an event with Targets is delivered: all, any or primary.
+	Success string `mapstructure:"success"`
+	// Rate limits dispatches of this directory, like the global Rate.
+	Rate string `mapstructure:"rate"`
+	// Burst is how many events of this directory may be dispatched at once above Rate.
+	Burst int `mapstructure:"burst"`
+}
+
+// TargetNames returns the sinks events of the directory are delivered to. output
+// is used when the watch selects none.
+func (w *WatchConfig) TargetNames(output string) []string {
+	if len(w.Targets) > 0 {
+		return w.Targets
+	}
+	if w.Sink != "" {
+		return []string{w.Sink}
+	}
+	return []string{output}
+}
+
+// RatePerSecond returns the dispatch rate limit of the directory, 0 when unlimited.
+func (w *WatchConfig) RatePerSecond() (float64, error) {
+	return parseRate(w.Rate)
+}
+
+func (w *WatchConfig) StaleAfterDuration() (time.Duration, error) {
+	if w.StaleAfter == "" {
+		return 0, nil
+	}
+	staleAfter, err := time.ParseDuration(w.StaleAfter)
+	if err != nil {
+		return 0, err
+	}
+	if staleAfter < 0 {
+		return 0, errors.New("stale_after must not be negative")
+	}
+	return staleAfter, nil
+}
+
+// Schedule returns the parsed active hours, or nil when the directory is always active.
+func (w *WatchConfig) Schedule() (*activeSchedule, error) {
+	if len(w.ActiveHours) == 0 {
+		return nil, nil
+	}
+	return parseActiveSchedule(w.ActiveHours, w.Timezone)
 }
 
 func (cfg *Config) InitDefaults() {
@@ -26,6 +426,20 @@ func (cfg *Config) InitDefaults() {
 
 	cfg.Pool.InitDefaults()
 
+	// Directories configured through watches are watched like dirs entries; the
+	// watch entries only carry their settings.
+	for i, watch := range cfg.Watches {
+		if watch.Dir != "" && !containsDir(cfg.WatchDirs(), filepath.Clean(watch.Dir)) {
+			cfg.Dirs = append(cfg.Dirs, watch.Dir)
+		}
+		if watch.Success == "" {
+			cfg.Watches[i].Success = SuccessAll
+		}
+		if watch.Rate != "" && watch.Burst == 0 {
+			cfg.Watches[i].Burst = 1
+		}
+	}
+
 	if cfg.Dir == "" && len(cfg.Dirs) == 0 {
 		cfg.Dir = "./lmx/results"
 	}
@@ -33,6 +447,100 @@ func (cfg *Config) InitDefaults() {
 	if cfg.Debounce == "" {
 		cfg.Debounce = "1s"
 	}
+
+	if cfg.DirCheckInterval == "" {
+		cfg.DirCheckInterval = "30s"
+	}
+
+	if cfg.PauseBuffer == 0 {
+		cfg.PauseBuffer = 10000
+	}
+
+	if cfg.PauseOverflow == "" {
+		cfg.PauseOverflow = OverflowDropOldest
+	}
+
+	if cfg.PendingOverflow == "" {
+		cfg.PendingOverflow = OverflowBlock
+	}
+
+	if cfg.MaxAttempts == 0 {
+		cfg.MaxAttempts = 1
+	}
+
+	if cfg.RetryBackoff == "" {
+		cfg.RetryBackoff = "5s"
+	}
+
+	if len(cfg.LatencyBuckets) == 0 {
+		cfg.LatencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+	}
+
+	if cfg.DegradedStatusCode == 0 {
+		cfg.DegradedStatusCode = http.StatusMultiStatus
+	}
+
+	if cfg.ErrorRateWindow == "" {
+		cfg.ErrorRateWindow = "5m"
+	}
+
+	if cfg.MaxErrorRate == 0 {
+		cfg.MaxErrorRate = 0.5
+	}
+
+	if cfg.ErrorRateMinDispatches == 0 {
+		cfg.ErrorRateMinDispatches = 10
+	}
+
+	if cfg.Output == "" {
+		cfg.Output = OutputPool
+	}
+
+	if cfg.Batch != nil {
+		if cfg.Batch.Size == 0 {
+			cfg.Batch.Size = 50
+		}
+		if cfg.Batch.Wait == "" {
+			cfg.Batch.Wait = "2s"
+		}
+	}
+
+	if cfg.Rate != "" && cfg.Burst == 0 {
+		cfg.Burst = 1
+	}
+
+	if cfg.CircuitBreaker != nil {
+		if cfg.CircuitBreaker.Failures == 0 {
+			cfg.CircuitBreaker.Failures = 5
+		}
+		if cfg.CircuitBreaker.OpenFor == "" {
+			cfg.CircuitBreaker.OpenFor = "30s"
+		}
+	}
+
+	if cfg.Ordering != nil {
+		if cfg.Ordering.Key == "" {
+			cfg.Ordering.Key = OrderPath
+			if cfg.Ordering.Pattern != "" {
+				cfg.Ordering.Key = OrderPattern
+			}
+		}
+		if cfg.Ordering.Parallelism == 0 {
+			cfg.Ordering.Parallelism = 4
+		}
+	}
+
+	if cfg.Jobs == nil && slices.Contains(cfg.SinkNames(), OutputJobs) {
+		cfg.Jobs = &JobsConfig{}
+	}
+	if cfg.Jobs != nil {
+		cfg.Jobs.InitDefaults()
+	}
+	for _, sink := range cfg.Sinks {
+		if sink != nil {
+			sink.InitDefaults()
+		}
+	}
 }
 
 func (cfg *Config) Validate() error {
@@ -42,9 +550,178 @@ func (cfg *Config) Validate() error {
 	if _, err := cfg.DebounceDuration(); err != nil {
 		return err
 	}
+	if _, err := cfg.DirCheckIntervalDuration(); err != nil {
+		return err
+	}
+	if cfg.PauseBuffer < 0 {
+		return errors.New("pause_buffer must not be negative")
+	}
+	if cfg.PauseOverflow != OverflowDropOldest && cfg.PauseOverflow != OverflowDropNewest {
+		return errors.New("pause_overflow must be drop_oldest or drop_newest")
+	}
+	if cfg.PendingCapacity < 0 {
+		return errors.New("pending_capacity must not be negative")
+	}
+	switch cfg.PendingOverflow {
+	case OverflowBlock, OverflowDropOldest:
+	case OverflowSpill:
+		if cfg.SpillDir == "" {
+			return errors.New("pending_overflow spill requires spill_dir")
+		}
+	default:
+		return errors.New("pending_overflow must be block, drop_oldest or spill")
+	}
+	if cfg.MaxAttempts < 1 {
+		return errors.New("max_attempts must be at least 1")
+	}
+	if _, err := cfg.RetryBackoffDuration(); err != nil {
+		return err
+	}
+	for i, bucket := range cfg.LatencyBuckets {
+		if bucket <= 0 || (i > 0 && bucket <= cfg.LatencyBuckets[i-1]) {
+			return errors.New("latency_buckets must be positive and strictly increasing")
+		}
+	}
+	for _, watch := range cfg.Watches {
+		if watch.Dir == "" {
+			return errors.New("every watches entry needs a dir")
+		}
+		if watch.Sink != "" && len(watch.Targets) > 0 {
+			return fmt.Errorf("watch %s: sink and targets must not be set together", watch.Dir)
+		}
+		for i, target := range watch.Targets {
+			if slices.Contains(watch.Targets[:i], target) {
+				return fmt.Errorf("watch %s: target %s is listed twice", watch.Dir, target)
+			}
+		}
+		switch watch.Success {
+		case SuccessAll, SuccessAny, SuccessPrimary:
+		default:
+			return fmt.Errorf("watch %s: success must be all, any or primary", watch.Dir)
+		}
+		if _, err := watch.StaleAfterDuration(); err != nil {
+			return err
+		}
+		if err := validateRate("watch "+watch.Dir+": ", watch.Rate, watch.Burst); err != nil {
+			return err
+		}
+		if _, err := watch.Schedule(); err != nil {
+			return err
+		}
+	}
+	if cfg.DegradedStatusCode < 100 || cfg.DegradedStatusCode > 599 {
+		return errors.New("degraded_status_code must be an HTTP status code")
+	}
+	if _, err := cfg.ErrorRateWindowDuration(); err != nil {
+		return err
+	}
+	if cfg.MaxErrorRate <= 0 || cfg.MaxErrorRate > 1 {
+		return errors.New("max_error_rate must be greater than 0 and at most 1")
+	}
+	if cfg.ErrorRateMinDispatches < 1 {
+		return errors.New("error_rate_min_dispatches must be at least 1")
+	}
+	if err := validateRate("", cfg.Rate, cfg.Burst); err != nil {
+		return err
+	}
+	if cfg.Batch != nil {
+		if cfg.Batch.Size < 1 {
+			return errors.New("batch.size must be at least 1")
+		}
+		if _, err := cfg.Batch.WaitDuration(); err != nil {
+			return err
+		}
+		if _, err := cfg.Batch.TimeoutDuration(); err != nil {
+			return err
+		}
+	}
+	if cfg.CircuitBreaker != nil {
+		if cfg.CircuitBreaker.Failures < 1 {
+			return errors.New("circuit_breaker.failures must be at least 1")
+		}
+		if _, err := cfg.CircuitBreaker.OpenForDuration(); err != nil {
+			return err
+		}
+	}
+	if cfg.Ordering != nil {
+		switch cfg.Ordering.Key {
+		case OrderPath, OrderDir, OrderPattern:
+		default:
+			return errors.New("ordering.key must be path, dir or pattern")
+		}
+		if _, err := cfg.Ordering.KeyPattern(); err != nil {
+			return err
+		}
+		if cfg.Ordering.Parallelism < 1 {
+			return errors.New("ordering.parallelism must be at least 1")
+		}
+		if cfg.Batch != nil {
+			return errors.New("ordering and batch must not be set together")
+		}
+	}
+	for name, sink := range cfg.Sinks {
+		if name == OutputPool || name == OutputJobs {
+			return fmt.Errorf("sinks.%s: the name is reserved for the built-in sink", name)
+		}
+		if sink == nil {
+			return fmt.Errorf("sinks.%s: type is required", name)
+		}
+		if err := sink.Validate(); err != nil {
+			return fmt.Errorf("sinks.%s: %w", name, err)
+		}
+	}
+	for _, name := range cfg.SinkNames() {
+		sink, ok := cfg.Sink(name)
+		if !ok {
+			return fmt.Errorf("unknown sink %q, expected pool, jobs or an entry of sinks", name)
+		}
+		if err := sink.Validate(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// SinkNames returns the sinks selected by Output and the sinks and targets of the
+// watches entries.
+func (cfg *Config) SinkNames() []string {
+	names := []string{cfg.Output}
+	for _, watch := range cfg.Watches {
+		for _, name := range watch.TargetNames(cfg.Output) {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// Sink returns the configuration of the named sink. "pool" and "jobs" are built in,
+// the jobs sink pushes to the pipeline configured in Jobs.
+func (cfg *Config) Sink(name string) (*SinkConfig, bool) {
+	if sink, ok := cfg.Sinks[name]; ok && sink != nil {
+		return sink, true
+	}
+	switch name {
+	case OutputPool:
+		return &SinkConfig{Type: OutputPool}, true
+	case OutputJobs:
+		return &SinkConfig{Type: OutputJobs, Jobs: cfg.Jobs}, cfg.Jobs != nil
+	}
+	return nil, false
+}
+
+// DispatchTimeout returns the deadline of one dispatch to the named sink: its
+// configured timeout, or defaultDispatchTimeout without one.
+func (cfg *Config) DispatchTimeout(name string) time.Duration {
+	if sink, ok := cfg.Sink(name); ok {
+		if timeout, err := sink.TimeoutDuration(); err == nil && timeout > 0 {
+			return timeout
+		}
+	}
+	return defaultDispatchTimeout
+}
+
 func (cfg *Config) WatchDirs() []string {
 	dirs := make([]string, 0, len(cfg.Dirs)+1)
 	if cfg.Dir != "" {
@@ -69,3 +746,93 @@ func (cfg *Config) DebounceDuration() (time.Duration, error) {
 	}
 	return debounce, nil
 }
+
+func (cfg *Config) DirCheckIntervalDuration() (time.Duration, error) {
+	interval, err := time.ParseDuration(cfg.DirCheckInterval)
+	if err != nil {
+		return 0, err
+	}
+	if interval < 0 {
+		return 0, errors.New("dir_check_interval must not be negative")
+	}
+	return interval, nil
+}
+
+func (cfg *Config) RetryBackoffDuration() (time.Duration, error) {
+	backoff, err := time.ParseDuration(cfg.RetryBackoff)
+	if err != nil {
+		return 0, err
+	}
+	if backoff < 0 {
+		return 0, errors.New("retry_backoff must not be negative")
+	}
+	return backoff, nil
+}
+
+// RatePerSecond returns the global dispatch rate limit, 0 when unlimited.
+func (cfg *Config) RatePerSecond() (float64, error) {
+	return parseRate(cfg.Rate)
+}
+
+// parseRate parses a rate such as "5/s", "300/m", "1000/h" or "1/500ms" into events
+// per second. An empty rate is 0.
+func parseRate(rate string) (float64, error) {
+	if rate == "" {
+		return 0, nil
+	}
+	count, per, ok := strings.Cut(rate, "/")
+	if !ok {
+		return 0, fmt.Errorf("rate %q must look like 5/s", rate)
+	}
+	events, err := strconv.ParseFloat(strings.TrimSpace(count), 64)
+	if err != nil || events <= 0 {
+		return 0, fmt.Errorf("rate %q needs a positive number of events", rate)
+	}
+	per = strings.TrimSpace(per)
+	switch per {
+	case "s", "m", "h":
+		per = "1" + per
+	}
+	interval, err := time.ParseDuration(per)
+	if err != nil || interval <= 0 {
+		return 0, fmt.Errorf("rate %q needs a positive interval", rate)
+	}
+	return events / interval.Seconds(), nil
+}
+
+// validateRate checks a rate limit and its burst; name prefixes the errors.
+func validateRate(name, rate string, burst int) error {
+	if _, err := parseRate(rate); err != nil {
+		return fmt.Errorf("%srate: %w", name, err)
+	}
+	if burst < 0 {
+		return fmt.Errorf("%sburst must not be negative", name)
+	}
+	if burst > 0 && rate == "" {
+		return fmt.Errorf("%sburst requires a rate", name)
+	}
+	return nil
+}
+
+func (cfg *Config) ErrorRateWindowDuration() (time.Duration, error) {
+	window, err := time.ParseDuration(cfg.ErrorRateWindow)
+	if err != nil {
+		return 0, err
+	}
+	if window < 0 {
+		return 0, errors.New("error_rate_window must not be negative")
+	}
+	return window, nil
+}
+
+// Watch returns the settings configured for dir, or empty settings when the
+// directory has no watches entry, for example when it was added through RPC.
+func (cfg *Config) Watch(dir string) WatchConfig {
+	dir = filepath.Clean(dir)
+	for _, watch := range cfg.Watches {
+		if filepath.Clean(watch.Dir) == dir {
+			return watch
+		}
+	}
+	return WatchConfig{Dir: dir}
+}
@@ -84,3 +84,79 @@ func TestConfigAllowsZeroDebounce(t *testing.T) {
 		t.Fatalf("expected zero debounce, got %s", debounce)
 	}
 }
+
+func TestConfigRejectsNegativeDirCheckInterval(t *testing.T) {
+	cfg := &Config{DirCheckInterval: "-1s"}
+	cfg.InitDefaults()
+
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected negative dir_check_interval to fail validation")
+	}
+}
+
+func TestConfigRejectsUnknownPauseOverflow(t *testing.T) {
+	cfg := &Config{PauseOverflow: "block"}
+	cfg.InitDefaults()
+
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected unknown pause_overflow to fail validation")
+	}
+}
+
+func TestConfigDefaultsToSingleAttempt(t *testing.T) {
+	cfg := &Config{}
+	cfg.InitDefaults()
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("default config should be valid: %v", err)
+	}
+	if cfg.MaxAttempts != 1 {
+		t.Fatalf("expected retries to be disabled by default, got %d attempts", cfg.MaxAttempts)
+	}
+}
+
+func TestConfigRejectsInvalidRetryBackoff(t *testing.T) {
+	cfg := &Config{RetryBackoff: "later"}
+	cfg.InitDefaults()
+
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected invalid retry_backoff to fail validation")
+	}
+}
+
+func TestConfigRejectsUnorderedLatencyBuckets(t *testing.T) {
+	cfg := &Config{LatencyBuckets: []float64{1, 0.5}}
+	cfg.InitDefaults()
+
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected unordered latency_buckets to fail validation")
+	}
+}
+
+func TestConfigWatchesAddTheirDirs(t *testing.T) {
+	cfg := &Config{
+		Dirs:    []string{"./lmx/results"},
+		Watches: []WatchConfig{{Dir: "./lmx/results/", StaleAfter: "2h"}, {Dir: "./lmx6/results"}},
+	}
+	cfg.InitDefaults()
+
+	dirs := cfg.WatchDirs()
+	if len(dirs) != 2 || dirs[1] != "./lmx6/results" {
+		t.Fatalf("unexpected watch dirs %#v", dirs)
+	}
+	if watch := cfg.Watch("lmx/results"); watch.StaleAfter != "2h" {
+		t.Fatalf("expected watch settings for lmx/results, got %#v", watch)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected watches to be valid: %v", err)
+	}
+}
+
+func TestConfigRejectsInvalidStaleAfter(t *testing.T) {
+	cfg := &Config{Watches: []WatchConfig{{Dir: "./lmx/results", StaleAfter: "-1h"}}}
+	cfg.InitDefaults()
+
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected negative stale_after to be rejected")
+	}
+}
@@ -0,0 +1,68 @@
+package roadrunner
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/radovskyb/watcher"
+	"github.com/roadrunner-server/errors"
+	"go.uber.org/zap"
+)
+
+// manualOps are the operations accepted by the Dispatch RPC method. Renames and
+// moves need an old path and are only produced by the watcher.
+var manualOps = map[string]watcher.Op{
+	"CREATE": watcher.Create,
+	"WRITE":  watcher.Write,
+	"REPLAY": opReplay,
+}
+
+// dispatchFile sends one file to a worker right away, bypassing the debounce
+// queue, and records the classified worker result in out. The returned error
+// only reports invalid requests; worker failures are part of the result.
+func (p *Plugin) dispatchFile(path string, opName string, out *DispatchResult) error {
+	const op = errors.Op("file_watch_dispatch_file")
+	if path == "" {
+		return errors.E(op, errors.Str("path is required"))
+	}
+	opName = strings.ToUpper(opName)
+	if opName == "" {
+		opName = "WRITE"
+	}
+	eventOp, ok := manualOps[opName]
+	if !ok {
+		return errors.E(op, errors.Errorf("unsupported op %q", opName))
+	}
+	if _, ok = p.watchDirContaining(path); !ok {
+		return errors.E(op, errors.Errorf("%q is not inside a watched directory", path))
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return errors.E(op, err)
+	}
+	if info.IsDir() {
+		return errors.E(op, errors.Errorf("%q is a directory", path))
+	}
+
+	p.log.Info("manual dispatch requested", zap.String("path", path), zap.String("op", opName))
+
+	start := time.Now()
+	dir := p.watchedDirectoryForEvent(path)
+	targets := p.newTargets(dir)
+	event := watcher.Event{Op: eventOp, Path: path, FileInfo: info}
+	p.deliverTargets(context.Background(), event, dir, targets)
+	err = targetsOutcome(p.cfg.Watch(dir).Success, targets)
+	p.recordOutcome(dir, event, err)
+
+	out.Path = path
+	out.Op = opName
+	out.ElapsedMs = time.Since(start).Milliseconds()
+	out.OK = err == nil
+	if err != nil {
+		out.Error = err.Error()
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package roadrunner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestDispatchFileRejectsPathOutsideWatchDirs(t *testing.T) {
+	outside := filepath.Join(t.TempDir(), "0001.game")
+	if err := os.WriteFile(outside, []byte("content"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	p := &Plugin{cfg: &Config{Dirs: []string{t.TempDir()}}, log: zap.NewNop()}
+
+	var out DispatchResult
+	if err := p.dispatchFile(outside, "CREATE", &out); err == nil {
+		t.Fatal("expected dispatch outside of the watch dirs to fail")
+	}
+}
+
+func TestDispatchFileRejectsUnsupportedOp(t *testing.T) {
+	dir := t.TempDir()
+	p := &Plugin{cfg: &Config{Dirs: []string{dir}}, log: zap.NewNop()}
+
+	var out DispatchResult
+	if err := p.dispatchFile(filepath.Join(dir, "0001.game"), "RENAME", &out); err == nil {
+		t.Fatal("expected RENAME to be rejected")
+	}
+}
+
+func TestDispatchFileReportsWorkerFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "0001.game")
+	if err := os.WriteFile(path, []byte("content"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	p := &Plugin{cfg: &Config{Dirs: []string{dir}}, log: zap.NewNop()}
+	p.metrics = newStatsExporter(p, nil)
+
+	var out DispatchResult
+	if err := p.dispatchFile(path, "", &out); err != nil {
+		t.Fatalf("expected valid request to be dispatched, got %v", err)
+	}
+	if out.OK {
+		t.Fatal("expected dispatch without a worker pool to fail")
+	}
+	if out.Op != "WRITE" || out.Path != path {
+		t.Fatalf("unexpected result %#v", out)
+	}
+	if !strings.Contains(out.Error, "not initialized") {
+		t.Fatalf("expected worker pool error, got %q", out.Error)
+	}
+}
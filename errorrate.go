@@ -0,0 +1,74 @@
+package roadrunner
+
+import (
+	"sync"
+	"time"
+)
+
+// errorRateBuckets is the number of buckets the error rate window is split into.
+const errorRateBuckets = 60
+
+// errorRate counts dispatch outcomes over a sliding window. The window is split
+// into buckets, so outcomes leave the window one bucket at a time.
+type errorRate struct {
+	mu      sync.Mutex
+	bucket  time.Duration
+	buckets [errorRateBuckets]outcomeBucket
+}
+
+type outcomeBucket struct {
+	// slot is the bucket index since the epoch, used to detect stale buckets.
+	slot   int64
+	ok     int
+	failed int
+}
+
+// newErrorRate returns a window of the given length, or nil when window is 0.
+func newErrorRate(window time.Duration) *errorRate {
+	if window <= 0 {
+		return nil
+	}
+	bucket := window / errorRateBuckets
+	if bucket <= 0 {
+		bucket = 1
+	}
+	return &errorRate{bucket: bucket}
+}
+
+// record counts one dispatch outcome. It does nothing on a nil window.
+func (r *errorRate) record(now time.Time, failed bool) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	slot := now.UnixNano() / int64(r.bucket)
+	b := &r.buckets[slot%errorRateBuckets]
+	if b.slot != slot {
+		*b = outcomeBucket{slot: slot}
+	}
+	if failed {
+		b.failed++
+	} else {
+		b.ok++
+	}
+}
+
+// counts returns the outcomes recorded inside the window ending at now.
+func (r *errorRate) counts(now time.Time) (ok, failed int) {
+	if r == nil {
+		return 0, 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	slot := now.UnixNano() / int64(r.bucket)
+	for _, b := range r.buckets {
+		if b.slot > slot-errorRateBuckets && b.slot <= slot {
+			ok += b.ok
+			failed += b.failed
+		}
+	}
+	return ok, failed
+}
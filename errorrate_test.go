@@ -0,0 +1,20 @@
+package roadrunner
+
+import (
+	"testing"
+	"time"
+)
+
+func TestErrorRateForgetsOutcomesOutsideWindow(t *testing.T) {
+	rate := newErrorRate(time.Minute)
+	start := time.Now()
+	rate.record(start, true)
+	rate.record(start.Add(30*time.Second), false)
+
+	if ok, failed := rate.counts(start.Add(45 * time.Second)); ok != 1 || failed != 1 {
+		t.Fatalf("expected both outcomes inside the window, got ok=%d failed=%d", ok, failed)
+	}
+	if ok, failed := rate.counts(start.Add(75 * time.Second)); ok != 1 || failed != 0 {
+		t.Fatalf("expected the failure to leave the window, got ok=%d failed=%d", ok, failed)
+	}
+}
@@ -0,0 +1,82 @@
+package roadrunner
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// EventType is the type of an event published on RoadRunner's events bus.
+// Subscribers match events of this plugin with patterns such as
+// "file_watch.FileFailed" or "file_watch.*".
+type EventType uint32
+
+const (
+	// EventFileDetected is published for every filesystem event received by the watcher.
+	EventFileDetected EventType = iota
+	// EventFileDispatched is published when a worker answered a dispatch with OK.
+	EventFileDispatched
+	// EventFileFailed is published for every failed dispatch attempt, including attempts that are retried.
+	EventFileFailed
+	// EventWatcherError is published when the file watcher reports an error.
+	EventWatcherError
+	// EventDirectoryLost is published when a watched directory disappears.
+	EventDirectoryLost
+)
+
+func (et EventType) String() string {
+	switch et {
+	case EventFileDetected:
+		return "FileDetected"
+	case EventFileDispatched:
+		return "FileDispatched"
+	case EventFileFailed:
+		return "FileFailed"
+	case EventWatcherError:
+		return "WatcherError"
+	case EventDirectoryLost:
+		return "DirectoryLost"
+	default:
+		return "UnknownEventType"
+	}
+}
+
+// BusEvent is an event of this plugin on RoadRunner's events bus. Go plugins can
+// type assert received events to *BusEvent; Message returns the same details as JSON.
+type BusEvent struct {
+	Kind EventType `json:"-"`
+	Dir  string    `json:"dir,omitempty"`
+	Path string    `json:"path,omitempty"`
+	// OldPath is the previous path of renamed or moved files.
+	OldPath string `json:"oldPath,omitempty"`
+	Op      string `json:"op,omitempty"`
+	// Target is the sink of FileDispatched and FileFailed.
+	Target  string `json:"target,omitempty"`
+	Attempt int    `json:"attempt,omitempty"`
+	// Reason is the failure reason of FileFailed, as in the jobs_failed_total metric.
+	Reason string `json:"reason,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+func (e *BusEvent) Type() fmt.Stringer {
+	return e.Kind
+}
+
+func (e *BusEvent) Plugin() string {
+	return PluginName
+}
+
+func (e *BusEvent) Message() string {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return e.Error
+	}
+	return string(data)
+}
+
+// publish sends ev to the events bus. It does nothing before Init.
+func (p *Plugin) publish(ev *BusEvent) {
+	if p.events == nil {
+		return
+	}
+	p.events.Send(ev)
+}
@@ -0,0 +1,65 @@
+package roadrunner
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/radovskyb/watcher"
+	"github.com/roadrunner-server/events"
+	"go.uber.org/zap"
+)
+
+func TestDispatchEventPublishesFileFailed(t *testing.T) {
+	bus, id := events.NewEventBus()
+	received := make(chan events.Event, 10)
+	if err := bus.SubscribeP(id, "file_watch.FileFailed", received); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	defer bus.Unsubscribe(id)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "0001.game")
+	if err := os.WriteFile(path, []byte("content"), 0644); err != nil {
+		t.Fatalf("failed to write result file: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat result file: %v", err)
+	}
+
+	// Without a worker pool every dispatch fails.
+	p := &Plugin{cfg: &Config{Dir: dir}, log: zap.NewNop(), events: bus}
+	p.metrics = newStatsExporter(p, nil)
+	if err = p.dispatchEvent(t.Context(), watcher.Event{Path: path, Op: watcher.Create, FileInfo: info}, OutputPool, 2); err == nil {
+		t.Fatal("expected dispatch without a worker pool to fail")
+	}
+
+	select {
+	case ev := <-received:
+		failed, ok := ev.(*BusEvent)
+		if !ok {
+			t.Fatalf("expected a *BusEvent, got %T", ev)
+		}
+		if failed.Kind != EventFileFailed || failed.Attempt != 2 || failed.Reason != failureTransport {
+			t.Fatalf("unexpected event %#v", failed)
+		}
+
+		var message map[string]any
+		if err := json.Unmarshal([]byte(ev.Message()), &message); err != nil {
+			t.Fatalf("expected a JSON message: %v", err)
+		}
+		if message["path"] != path || message["dir"] != dir {
+			t.Fatalf("unexpected message %s", ev.Message())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a FileFailed event")
+	}
+}
+
+func TestPublishWithoutBusIsNoop(t *testing.T) {
+	p := &Plugin{}
+	p.publish(&BusEvent{Kind: EventWatcherError, Error: "boom"})
+}
@@ -0,0 +1,110 @@
+package roadrunner
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/radovskyb/watcher"
+	"github.com/roadrunner-server/pool/fsm"
+)
+
+// inFlightDispatch is an event currently executed by a worker.
+type inFlightDispatch struct {
+	path    string
+	op      string
+	attempt int
+	started time.Time
+}
+
+// inFlightDispatches tracks the events currently executed by workers.
+type inFlightDispatches struct {
+	mu     sync.Mutex
+	nextID uint64
+	active map[uint64]inFlightDispatch
+}
+
+// start registers a dispatch and returns the function that unregisters it.
+func (d *inFlightDispatches) start(event watcher.Event, attempt int, started time.Time) func() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.active == nil {
+		d.active = make(map[uint64]inFlightDispatch)
+	}
+	d.nextID++
+	id := d.nextID
+	d.active[id] = inFlightDispatch{path: event.Path, op: opName(event.Op), attempt: attempt, started: started}
+
+	return func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		delete(d.active, id)
+	}
+}
+
+func (d *inFlightDispatches) list() []inFlightDispatch {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	dispatches := make([]inFlightDispatch, 0, len(d.active))
+	for _, dispatch := range d.active {
+		dispatches = append(dispatches, dispatch)
+	}
+	slices.SortFunc(dispatches, func(a, b inFlightDispatch) int {
+		return a.started.Compare(b.started)
+	})
+	return dispatches
+}
+
+// pendingEvents returns a copy of the events waiting in the debounce queue,
+// ordered by the time they become ready.
+func (p *Plugin) pendingEvents() []PendingEvent {
+	p.pendingMu.Lock()
+	defer p.pendingMu.Unlock()
+
+	events := make([]PendingEvent, 0, len(p.pending))
+	for path, pendingEvent := range p.pending {
+		events = append(events, PendingEvent{
+			Path:    path,
+			Op:      opName(pendingEvent.event.Op),
+			Seq:     pendingEvent.seq,
+			FireAt:  pendingEvent.fireAt.Format(time.RFC3339Nano),
+			Attempt: pendingEvent.attempt,
+			Held:    pendingEvent.held,
+		})
+	}
+	slices.SortFunc(events, func(a, b PendingEvent) int {
+		return p.pending[a.Path].fireAt.Compare(p.pending[b.Path].fireAt)
+	})
+	return events
+}
+
+// inFlightEvents returns the dispatches currently executed by workers together
+// with the PIDs of the workers in the working state.
+func (p *Plugin) inFlightEvents() ([]InFlightDispatch, []int64) {
+	var working []int64
+	for _, state := range p.Workers() {
+		if state.Status == fsm.StateWorking {
+			working = append(working, state.Pid)
+		}
+	}
+
+	active := p.inFlight.list()
+	dispatches := make([]InFlightDispatch, 0, len(active))
+	for _, dispatch := range active {
+		dispatches = append(dispatches, InFlightDispatch{
+			Path:    dispatch.path,
+			Op:      dispatch.op,
+			Attempt: dispatch.attempt,
+			Started: dispatch.started.Format(time.RFC3339Nano),
+		})
+	}
+
+	// The pool does not report which worker executes a payload. With a single
+	// dispatch and a single busy worker the match is unambiguous.
+	if len(dispatches) == 1 && len(working) == 1 {
+		dispatches[0].WorkerPID = working[0]
+	}
+	return dispatches, working
+}
@@ -0,0 +1,51 @@
+package roadrunner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/radovskyb/watcher"
+)
+
+func TestPendingEventsOrderedByFireTime(t *testing.T) {
+	pending := make(map[string]*pendingFileEvent)
+	timers := newEventTimers()
+	scheduleDebouncedEvent(pending, timers, watcher.Event{Path: "late.game", Op: watcher.Create}, time.Hour)
+	scheduleDebouncedEvent(pending, timers, watcher.Event{Path: "soon.game", Op: watcher.Create}, time.Minute)
+	scheduleDebouncedEvent(pending, timers, watcher.Event{Path: "soon.game", Op: watcher.Write}, time.Minute)
+	defer stopPendingEvents(pending)
+
+	p := &Plugin{pending: pending}
+	events := p.pendingEvents()
+
+	if len(events) != 2 {
+		t.Fatalf("expected two pending events, got %d", len(events))
+	}
+	if events[0].Path != "soon.game" || events[1].Path != "late.game" {
+		t.Fatalf("expected events ordered by fire time, got %q and %q", events[0].Path, events[1].Path)
+	}
+	if events[0].Op != "WRITE" || events[0].Seq != 2 {
+		t.Fatalf("expected latest coalesced event, got op %s seq %d", events[0].Op, events[0].Seq)
+	}
+}
+
+func TestInFlightEventsTrackRunningDispatches(t *testing.T) {
+	p := &Plugin{}
+
+	done := p.inFlight.start(watcher.Event{Path: "result.game", Op: opReplay}, 2, time.Now())
+	dispatches, working := p.inFlightEvents()
+	if len(dispatches) != 1 {
+		t.Fatalf("expected one in-flight dispatch, got %d", len(dispatches))
+	}
+	if dispatches[0].Path != "result.game" || dispatches[0].Op != "REPLAY" || dispatches[0].Attempt != 2 {
+		t.Fatalf("unexpected in-flight dispatch %#v", dispatches[0])
+	}
+	if len(working) != 0 || dispatches[0].WorkerPID != 0 {
+		t.Fatal("expected no worker PID without a worker pool")
+	}
+
+	done()
+	if dispatches, _ = p.inFlightEvents(); len(dispatches) != 0 {
+		t.Fatalf("expected finished dispatch to be removed, got %#v", dispatches)
+	}
+}
@@ -3,6 +3,7 @@ package roadrunner
 import (
 	"context"
 	"github.com/roadrunner-server/api/v4/plugins/v1/status"
+	jobsApi "github.com/roadrunner-server/api/v4/plugins/v4/jobs"
 	"github.com/roadrunner-server/pool/payload"
 	"github.com/roadrunner-server/pool/pool"
 	staticPool "github.com/roadrunner-server/pool/pool/static_pool"
@@ -35,6 +36,12 @@ type Server interface {
 	NewPool(ctx context.Context, cfg *pool.Config, env map[string]string, _ *zap.Logger) (*staticPool.Pool, error)
 }
 
+// Jobs is RoadRunner's jobs plugin, which jobs sinks push events to.
+type Jobs interface {
+	// Push pushes a job into the pipeline named by its GroupID.
+	Push(ctx context.Context, msg jobsApi.Message) error
+}
+
 type Logger interface {
 	NamedLogger(name string) *zap.Logger
 }
@@ -0,0 +1,99 @@
+package roadrunner
+
+import (
+	"context"
+	"maps"
+
+	"github.com/google/uuid"
+	rrErrors "github.com/roadrunner-server/errors"
+	"github.com/roadrunner-server/pool/payload"
+)
+
+// jobsSink pushes events as jobs into a pipeline of RoadRunner's jobs plugin. The
+// jobs plugin is collected by the plugin and called in-process.
+type jobsSink struct {
+	cfg *JobsConfig
+	p   *Plugin
+}
+
+func newJobsSink(cfg *JobsConfig, p *Plugin) *jobsSink {
+	return &jobsSink{cfg: cfg, p: p}
+}
+
+// Deliver sends the payload as a job into the configured pipeline. The job payload is
+// the event JSON, and the W3C trace context from the payload context is sent as
+// job headers.
+func (c *jobsSink) Deliver(ctx context.Context, pld *payload.Payload) ([]byte, error) {
+	const op = rrErrors.Op("file_watch_jobs_push")
+	c.p.mu.RLock()
+	jobs := c.p.jobs
+	c.p.mu.RUnlock()
+	if jobs == nil {
+		return nil, rrErrors.E(op, rrErrors.Str("jobs plugin is not available"))
+	}
+
+	msg := &jobMessage{
+		id:       uuid.NewString(),
+		name:     c.cfg.Name,
+		pipeline: c.cfg.Pipeline,
+		priority: c.cfg.Priority,
+		delay:    c.cfg.Delay,
+		autoAck:  c.cfg.AutoAck,
+		payload:  pld.Body,
+		headers:  make(map[string][]string),
+	}
+	for key, value := range carrierHeaders(pld) {
+		msg.headers[key] = []string{value}
+	}
+	if err := jobs.Push(ctx, msg); err != nil {
+		if ctx.Err() != nil {
+			return nil, rrErrors.E(op, rrErrors.ExecTTL, ctx.Err())
+		}
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (c *jobsSink) Close() error {
+	return nil
+}
+
+// jobMessage is a job pushed into a pipeline. It implements the jobs plugin's
+// Message; the Kafka options are left empty.
+type jobMessage struct {
+	id       string
+	name     string
+	pipeline string
+	priority int64
+	delay    int64
+	autoAck  bool
+	payload  []byte
+	headers  map[string][]string
+}
+
+func (m *jobMessage) ID() string { return m.id }
+
+// GroupID is the pipeline the job is pushed to.
+func (m *jobMessage) GroupID() string { return m.pipeline }
+
+func (m *jobMessage) Priority() int64 { return m.priority }
+
+func (m *jobMessage) UpdatePriority(priority int64) { m.priority = priority }
+
+func (m *jobMessage) Name() string { return m.name }
+
+func (m *jobMessage) Payload() []byte { return m.payload }
+
+func (m *jobMessage) Delay() int64 { return m.delay }
+
+func (m *jobMessage) AutoAck() bool { return m.autoAck }
+
+func (m *jobMessage) Headers() map[string][]string { return maps.Clone(m.headers) }
+
+func (m *jobMessage) Offset() int64 { return 0 }
+
+func (m *jobMessage) Partition() int32 { return 0 }
+
+func (m *jobMessage) Topic() string { return "" }
+
+func (m *jobMessage) Metadata() string { return "" }
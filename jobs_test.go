@@ -0,0 +1,69 @@
+package roadrunner
+
+import (
+	"context"
+	"testing"
+
+	jobsApi "github.com/roadrunner-server/api/v4/plugins/v4/jobs"
+	"github.com/roadrunner-server/pool/payload"
+)
+
+// fakeJobs records the jobs pushed into it.
+type fakeJobs struct {
+	pushed chan jobsApi.Message
+}
+
+func (j *fakeJobs) Push(_ context.Context, msg jobsApi.Message) error {
+	j.pushed <- msg
+	return nil
+}
+
+func TestJobsSinkPushesEventIntoPipeline(t *testing.T) {
+	jobs := &fakeJobs{pushed: make(chan jobsApi.Message, 1)}
+	cfg := &Config{Output: OutputJobs, Jobs: &JobsConfig{Pipeline: "imports"}}
+	cfg.InitDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected jobs config to be valid: %v", err)
+	}
+	p := &Plugin{cfg: cfg}
+	// RoadRunner hands over the jobs plugin through the collected dependency.
+	collects := p.Collects()
+	if len(collects) != 1 {
+		t.Fatalf("expected the jobs plugin to be collected, got %d dependencies", len(collects))
+	}
+	collects[0].Fn(jobs)
+	sink := newJobsSink(cfg.Jobs, p)
+
+	pld := &payload.Payload{Body: []byte(`{"path":"./lmx/results/0001.game"}`), Context: []byte(`{"traceparent":"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}`)}
+	if _, err := sink.Deliver(t.Context(), pld); err != nil {
+		t.Fatalf("Deliver returned error: %v", err)
+	}
+
+	job := <-jobs.pushed
+	if job.Name() != PluginName || job.GroupID() != "imports" || job.Priority() != 10 || job.ID() == "" {
+		t.Fatalf("unexpected job %s in %s with priority %d", job.Name(), job.GroupID(), job.Priority())
+	}
+	if string(job.Payload()) != string(pld.Body) {
+		t.Fatalf("expected the event JSON as job payload, got %s", job.Payload())
+	}
+	if got := job.Headers()["traceparent"]; len(got) != 1 {
+		t.Fatalf("expected the trace context as job header, got %v", job.Headers())
+	}
+}
+
+func TestJobsSinkFailsWithoutJobsPlugin(t *testing.T) {
+	sink := newJobsSink(&JobsConfig{Pipeline: "imports"}, &Plugin{})
+
+	if _, err := sink.Deliver(t.Context(), &payload.Payload{}); err == nil {
+		t.Fatal("expected a push without the jobs plugin to fail")
+	}
+}
+
+func TestConfigRejectsJobsOutputWithoutPipeline(t *testing.T) {
+	cfg := &Config{Output: OutputJobs, Jobs: &JobsConfig{}}
+	cfg.InitDefaults()
+
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected jobs output without pipeline to be rejected")
+	}
+}
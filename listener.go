@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 	"time"
 
@@ -14,12 +16,17 @@ import (
 	"github.com/roadrunner-server/goridge/v3/pkg/frame"
 	"github.com/roadrunner-server/pool/payload"
 	"github.com/roadrunner-server/pool/pool/static_pool"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
 const (
 	workerResponseOK    = "OK"
 	workerResponseError = "ERROR"
+
+	// opReplay marks events produced by a rescan instead of the filesystem watcher.
+	opReplay watcher.Op = 100
 )
 
 func (p *Plugin) listener() error {
@@ -43,16 +50,28 @@ func (p *Plugin) listener() error {
 		return err
 	}
 
+	dirCheckInterval, err := p.cfg.DirCheckIntervalDuration()
+	if err != nil {
+		return err
+	}
+
 	p.watcher = w
 	stopCh := p.stopCh
+	resumeCh := p.resumeCh
+	replays := p.replayCh
 
 	p.log.Debug("Starting file watch", zap.Strings("dirs", dirs), zap.String("regexp", p.cfg.Regexp), zap.Duration("debounce", debounce))
 
-	go p.watchEvents(w, debounce, stopCh)
+	go p.watchEvents(w, debounce, stopCh, resumeCh, replays)
+	if dirCheckInterval > 0 {
+		go p.watchDirChecks(dirCheckInterval, stopCh)
+	}
 
 	go func() {
 		if err := w.Start(time.Millisecond * 100); err != nil {
+			p.watcherErr.Store(&err)
 			p.log.Error("file watcher stopped with error", zap.Error(err))
+			p.publish(&BusEvent{Kind: EventWatcherError, Error: err.Error()})
 		}
 	}()
 	w.Wait()
@@ -60,6 +79,8 @@ func (p *Plugin) listener() error {
 	return nil
 }
 
+// debouncedFileEvent is a due timer of the pending event for path, taken from
+// eventTimers.
 type debouncedFileEvent struct {
 	path string
 	seq  uint64
@@ -67,95 +88,515 @@ type debouncedFileEvent struct {
 
 type pendingFileEvent struct {
 	event watcher.Event
-	seq   uint64
-	timer *time.Timer
+	// seq identifies the latest schedule of the event; timers scheduled before it
+	// are stale.
+	seq uint64
+	// fireAt is when the debounce or retry timer dispatches the event.
+	fireAt time.Time
+	// detected is when the first event coalesced into this one was received.
+	detected time.Time
+	// attempt counts failed dispatches of the event.
+	attempt int
+	// targets holds the delivery state of each target sink, created at the first
+	// dispatch attempt.
+	targets []*targetState
+	// created records that the path was created while the event was pending, so a
+	// later rename of the path can be reported as a create of the final name.
+	created bool
+	// held marks an event that became ready while dispatch was paused.
+	held bool
+	// limited marks an event that waits for its turn under a rate limit.
+	limited bool
+	// queueID is the write-ahead log record of the latest change coalesced into the
+	// event, 0 when it is not in the log.
+	queueID uint64
+	// jobs are the rescan jobs waiting for the outcome of this event.
+	jobs []*rescanJob
+	// span is the trace span of the event, started at the first dispatch attempt
+	// and ended once the event is done. ctx carries it to the dispatch spans.
+	ctx  context.Context
+	span trace.Span
 }
 
-func (p *Plugin) watchEvents(w *watcher.Watcher, debounce time.Duration, stopCh <-chan struct{}) {
+// schedule (re)starts the timer that marks the event ready after delay.
+func (e *pendingFileEvent) schedule(timers *eventTimers, delay time.Duration) {
+	e.seq++
+	e.fireAt = time.Now().Add(delay)
+	timers.schedule(e.event.Path, e.seq, e.fireAt)
+}
+
+// replayEvent is a file found by a rescan job.
+type replayEvent struct {
+	event watcher.Event
+	job   *rescanJob
+}
+
+func (p *Plugin) watchEvents(w *watcher.Watcher, debounce time.Duration, stopCh <-chan struct{}, resumeCh <-chan struct{}, replays <-chan replayEvent) {
 	pending := make(map[string]*pendingFileEvent)
-	ready := make(chan debouncedFileEvent, 1024)
+	timers := newEventTimers()
+	// held lists the paths of held events in the order they became ready.
+	var held []string
+	// blocked is a file event that waits for room in the full pending queue with
+	// pending_overflow block. No further events are read until it is queued.
+	var blocked *blockedEvent
+
+	// flushCh and orderedCh stay nil without batch mode and ordering, so the loop
+	// never selects them.
+	var flushCh <-chan uint64
+	if p.batch != nil {
+		flushCh = p.batch.flushCh
+	}
+	var orderedCh <-chan orderedResult
+	if p.ordered != nil {
+		orderedCh = p.ordered.done
+	}
+
+	// The loop is the only writer of pending. It is shared under pendingMu so the
+	// Pending RPC method can inspect the queue; see dispatchPendingEvent.
+	p.pendingMu.Lock()
+	p.pending = pending
+	p.deadLetters = make(map[string]time.Time)
+	p.recoverEvents(pending, timers, p.recovered)
+	p.recovered = nil
+	p.pendingMu.Unlock()
 
 	for {
+		// Events that waited for room are queued once dispatches made some.
+		if blocked != nil || p.spill.len() > 0 {
+			p.pendingMu.Lock()
+			held, blocked = p.refillPending(pending, timers, held, blocked, debounce)
+			p.updateQueueMetrics(pending, timers)
+			p.pendingMu.Unlock()
+		}
+		// While an event is blocked the watcher and rescans wait until it is queued.
+		events, replayed := w.Event, replays
+		if blocked != nil {
+			events, replayed = nil, nil
+		}
+
 		select {
 		case <-stopCh:
+			p.pendingMu.Lock()
+			p.stopBatch()
+			p.stopOrdered(pending, timers)
 			stopPendingEvents(pending)
+			timers.stop()
+			p.closeQueue()
+			p.closeSpill()
+			p.pendingMu.Unlock()
 			p.log.Debug("------> file watch poller was stopped <------")
 			return
-		case event := <-w.Event:
+		case event := <-events:
 			p.log.Debug("Received a file event", zap.String("event", event.String()))
 
-			p.metrics.CountEvents()
-
-			if debounce > 0 {
-				scheduleDebouncedEvent(pending, ready, event, debounce)
-				p.log.Debug("file event scheduled by debounce", zap.String("path", event.Path), zap.Duration("debounce", debounce))
-				continue
+			dir := p.watchedDirectoryForEvent(event.Path)
+			p.metrics.CountEvents(dir, opName(event.Op))
+			detected := &BusEvent{Kind: EventFileDetected, Dir: dir, Path: event.Path, Op: opName(event.Op)}
+			if isRenameEvent(event) {
+				detected.OldPath = event.OldPath
 			}
-
-			p.dispatchEvent(event)
-		case eventRef := <-ready:
-			pendingEvent, ok := pending[eventRef.path]
-			if !ok || pendingEvent.seq != eventRef.seq {
-				continue
+			p.publish(detected)
+
+			p.pendingMu.Lock()
+			queueID := p.queue.add(event, p.log)
+			if p.pendingFull(pending, event) {
+				held, blocked = p.overflowEvent(pending, timers, held, event, queueID, debounce)
+			} else {
+				held = p.queueFileEvent(pending, timers, held, event, queueID, debounce)
 			}
-			event := pendingEvent.event
-			delete(pending, eventRef.path)
-
-			p.dispatchEvent(event)
+			p.updateQueueMetrics(pending, timers)
+			p.pendingMu.Unlock()
+		case <-timers.C:
+			p.pendingMu.Lock()
+			for _, eventRef := range timers.due(time.Now()) {
+				pendingEvent, ok := pending[eventRef.path]
+				if ok && pendingEvent.seq == eventRef.seq {
+					held = p.readyEvent(pending, timers, held, pendingEvent)
+				}
+			}
+			p.updateQueueMetrics(pending, timers)
+			p.pendingMu.Unlock()
+		case replay := <-replayed:
+			p.pendingMu.Lock()
+			// Replayed files already exist, so they skip the debounce window.
+			pendingEvent := queueEvent(pending, replay.event)
+			pendingEvent.jobs = append(pendingEvent.jobs, replay.job)
+
+			held = p.readyEvent(pending, timers, held, pendingEvent)
+			p.updateQueueMetrics(pending, timers)
+			p.pendingMu.Unlock()
+		case <-resumeCh:
+			p.pendingMu.Lock()
+			held = p.dispatchHeldEvents(pending, timers, held)
+			// A batch whose wait ended while paused is sent now.
+			if p.batch != nil && !p.paused.Load() {
+				p.flushBatch(pending, timers)
+			}
+			if p.ordered != nil {
+				p.startOrdered(pending)
+			}
+			p.updateQueueMetrics(pending, timers)
+			p.pendingMu.Unlock()
+		case seq := <-flushCh:
+			p.pendingMu.Lock()
+			// Paused batches are sent on resume.
+			if seq == p.batch.seq && !p.paused.Load() {
+				p.flushBatch(pending, timers)
+			}
+			p.updateQueueMetrics(pending, timers)
+			p.pendingMu.Unlock()
+		case result := <-orderedCh:
+			p.pendingMu.Lock()
+			p.finishOrdered(pending, timers, result)
+			p.updateQueueMetrics(pending, timers)
+			p.pendingMu.Unlock()
 		case err := <-w.Error:
 			p.log.Error(err.Error())
+			p.publish(&BusEvent{Kind: EventWatcherError, Error: err.Error()})
 		case <-w.Closed:
+			p.pendingMu.Lock()
+			p.stopBatch()
+			p.stopOrdered(pending, timers)
 			stopPendingEvents(pending)
+			timers.stop()
+			p.closeQueue()
+			p.closeSpill()
+			p.pendingMu.Unlock()
 			p.log.Debug("File watch closing")
 			return
 		}
 	}
 }
 
-func scheduleDebouncedEvent(pending map[string]*pendingFileEvent, ready chan<- debouncedFileEvent, event watcher.Event, debounce time.Duration) {
-	path := event.Path
-	current, ok := pending[path]
+// queueFileEvent queues an event of the watcher, debounced unless debounce is 0.
+// queueID is its write-ahead log record. The caller must hold pendingMu.
+func (p *Plugin) queueFileEvent(pending map[string]*pendingFileEvent, timers *eventTimers, held []string, event watcher.Event, queueID uint64, debounce time.Duration) []string {
+	if debounce > 0 {
+		// A rename cancels the event still pending for the old path.
+		if old, ok := pending[event.OldPath]; ok && isRenameEvent(event) {
+			p.queue.done(event.OldPath, old.queueID, p.log)
+		}
+		scheduleDebouncedEvent(pending, timers, event, debounce)
+		pending[event.Path].queueID = max(pending[event.Path].queueID, queueID)
+		p.log.Debug("file event scheduled by debounce", zap.String("path", event.Path), zap.Duration("debounce", debounce))
+		return held
+	}
+
+	pendingEvent := queueEvent(pending, event)
+	pendingEvent.queueID = max(pendingEvent.queueID, queueID)
+	return p.readyEvent(pending, timers, held, pendingEvent)
+}
+
+func scheduleDebouncedEvent(pending map[string]*pendingFileEvent, timers *eventTimers, event watcher.Event, debounce time.Duration) {
+	created := event.Op == watcher.Create
+	detected := time.Now()
+	var jobs []*rescanJob
+	if isRenameEvent(event) {
+		// The old path no longer exists, so anything still waiting for it would only
+		// make the worker look for a missing file. A file that was created under the
+		// old name and renamed before it was dispatched (write-to-temp-then-rename) is
+		// new to the worker, so it is reported as a single create of the final name.
+		// Rescan jobs waiting for the old path wait for the new one instead.
+		if old, ok := pending[event.OldPath]; ok {
+			delete(pending, event.OldPath)
+			old.endSpan(nil)
+			jobs = old.jobs
+			if old.created {
+				event.Op = watcher.Create
+				event.OldPath = ""
+				created = true
+				detected = old.detected
+			}
+		}
+	}
+
+	current, ok := pending[event.Path]
 	if !ok {
-		current = &pendingFileEvent{}
-		pending[path] = current
+		current = &pendingFileEvent{detected: detected}
+		pending[event.Path] = current
 	}
 
-	if current.timer != nil {
-		current.timer.Stop()
+	current.event = event
+	current.jobs = append(current.jobs, jobs...)
+	current.created = current.created || created
+	// A new change of the file deserves a fresh set of attempts.
+	current.attempt = 0
+	current.targets = nil
+	current.limited = false
+	current.schedule(timers, debounce)
+}
+
+// queueEvent replaces the pending event for the path with an event that is
+// ready right away. Any debounce or retry timer of the path becomes stale.
+func queueEvent(pending map[string]*pendingFileEvent, event watcher.Event) *pendingFileEvent {
+	current, ok := pending[event.Path]
+	if !ok {
+		current = &pendingFileEvent{detected: time.Now()}
+		pending[event.Path] = current
 	}
 
 	current.event = event
+	current.attempt = 0
+	current.targets = nil
+	current.limited = false
 	current.seq++
-	seq := current.seq
-	current.timer = time.AfterFunc(debounce, func() {
-		ready <- debouncedFileEvent{path: path, seq: seq}
+	current.fireAt = time.Now()
+	return current
+}
+
+// readyEvent dispatches a pending event whose timer has fired, or holds it while
+// dispatch is paused.
+func (p *Plugin) readyEvent(pending map[string]*pendingFileEvent, timers *eventTimers, held []string, pendingEvent *pendingFileEvent) []string {
+	if p.paused.Load() {
+		return p.holdEvent(pending, held, pendingEvent)
+	}
+
+	p.dispatchPendingEvent(pending, timers, pendingEvent)
+	return held
+}
+
+// dispatchPendingEvent removes the event from pending and dispatches it, adds it
+// to the batch in batch mode, or queues it for its ordering key. Events for a sink
+// with an open circuit breaker or over a rate limit stay pending until they may go.
+// A failed dispatch is scheduled again with exponential backoff until max_attempts
+// is reached. The caller must hold pendingMu; it is released while the worker runs.
+func (p *Plugin) dispatchPendingEvent(pending map[string]*pendingFileEvent, timers *eventTimers, pendingEvent *pendingFileEvent) {
+	if p.breakEvent(timers, pendingEvent) || p.limitEvent(timers, pendingEvent) {
+		return
+	}
+	if p.batch != nil {
+		p.batchEvent(pending, timers, pendingEvent)
+		return
+	}
+	if p.ordered != nil {
+		p.orderEvent(pending, pendingEvent)
+		return
+	}
+
+	dir := p.startDispatch(pending, pendingEvent)
+
+	p.pendingMu.Unlock()
+	p.deliverTargets(pendingEvent.ctx, pendingEvent.event, dir, pendingEvent.targets)
+	p.pendingMu.Lock()
+
+	p.finishDispatch(pending, timers, pendingEvent, dir)
+}
+
+// startDispatch removes the event from pending before it is delivered and
+// returns its watched directory. The caller must hold pendingMu.
+func (p *Plugin) startDispatch(pending map[string]*pendingFileEvent, pendingEvent *pendingFileEvent) string {
+	delete(pending, pendingEvent.event.Path)
+	pendingEvent.held = false
+
+	if pendingEvent.attempt == 0 {
+		p.metrics.ObserveDebounceWait(time.Since(pendingEvent.detected))
+	}
+	p.startEventSpan(pendingEvent)
+	dir := p.watchedDirectoryForEvent(pendingEvent.event.Path)
+	if pendingEvent.targets == nil {
+		pendingEvent.targets = p.newTargets(dir)
+	}
+	return dir
+}
+
+// finishDispatch schedules a retry for targets that failed and are not given up,
+// or completes the event. The caller must hold pendingMu.
+func (p *Plugin) finishDispatch(pending map[string]*pendingFileEvent, timers *eventTimers, pendingEvent *pendingFileEvent, dir string) {
+	err := targetsOutcome(p.cfg.Watch(dir).Success, pendingEvent.targets)
+	p.recordOutcome(dir, pendingEvent.event, err)
+
+	if current, ok := pending[pendingEvent.event.Path]; ok && !targetsDone(pendingEvent.targets) {
+		// The file changed again during a parallel dispatch. The new change is
+		// delivered to every target anyway, so it replaces the retry.
+		current.jobs = append(current.jobs, pendingEvent.jobs...)
+		pendingEvent.endSpan(nil)
+		return
+	}
+	if !targetsDone(pendingEvent.targets) {
+		// Targets that succeeded are skipped by the retry.
+		backoff, _ := p.cfg.RetryBackoffDuration()
+		delay := backoff << pendingEvent.attempt
+		pendingEvent.attempt++
+		pending[pendingEvent.event.Path] = pendingEvent
+		pendingEvent.schedule(timers, delay)
+		pendingEvent.span.AddEvent("retry scheduled", trace.WithAttributes(attribute.Int("file_watch.attempt", pendingEvent.attempt), attribute.String("file_watch.delay", delay.String())))
+
+		p.log.Warn("dispatch failed, retry scheduled", zap.String("path", pendingEvent.event.Path), zap.Int("attempt", pendingEvent.attempt), zap.Duration("delay", delay))
+		return
+	}
+
+	if err == nil {
+		p.metrics.ObserveEndToEnd(time.Since(pendingEvent.detected))
+	}
+	if err != nil && p.cfg.MaxAttempts > 1 {
+		p.log.Error("dispatch failed, giving up", zap.String("path", pendingEvent.event.Path), zap.Int("attempts", pendingEvent.attempt+1))
+	}
+	p.recordDeadLetter(pendingEvent.event.Path, err)
+	p.queue.done(pendingEvent.event.Path, pendingEvent.queueID, p.log)
+	pendingEvent.endSpan(err)
+
+	for _, job := range pendingEvent.jobs {
+		job.done(err)
+	}
+}
+
+// recordDeadLetter remembers files whose last dispatch attempt failed until a
+// later dispatch of the same path succeeds. The caller must hold pendingMu.
+func (p *Plugin) recordDeadLetter(path string, err error) {
+	if err == nil {
+		delete(p.deadLetters, path)
+		return
+	}
+	if p.deadLetters == nil {
+		p.deadLetters = make(map[string]time.Time)
+	}
+	p.deadLetters[path] = time.Now()
+}
+
+// updateQueueMetrics publishes the queue gauges. The caller must hold pendingMu.
+func (p *Plugin) updateQueueMetrics(pending map[string]*pendingFileEvent, timers *eventTimers) {
+	var debouncing, retrying int
+	var oldest time.Time
+	// Ready events waiting for their ordering key are counted as waiting.
+	queued := p.ordered.queued(pending)
+	for _, pendingEvent := range pending {
+		if oldest.IsZero() || pendingEvent.detected.Before(oldest) {
+			oldest = pendingEvent.detected
+		}
+		if _, ok := queued[pendingEvent]; ok {
+			continue
+		}
+		if pendingEvent.attempt > 0 {
+			retrying++
+		} else {
+			debouncing++
+		}
+	}
+
+	p.metrics.SetQueue(debouncing, timers.overdue(pending, time.Now())+len(queued), retrying, len(p.deadLetters), oldest)
+}
+
+// holdEvent keeps a ready event in pending while dispatch is paused and records
+// the number of held events.
+func (p *Plugin) holdEvent(pending map[string]*pendingFileEvent, held []string, pendingEvent *pendingFileEvent) []string {
+	held, dropped := holdPendingEvent(pending, held, pendingEvent.event.Path, p.cfg.PauseBuffer, p.cfg.PauseOverflow)
+	if dropped != nil {
+		p.log.Warn("pause buffer is full, event dropped", zap.String("path", dropped.event.Path), zap.String("overflow", p.cfg.PauseOverflow))
+		p.dropEvent(dropped, rrErrors.Str("event dropped while paused"))
+	}
+	p.held.Store(int64(len(held)))
+	return held
+}
+
+// dropEvent gives up an event that was removed from pending without a dispatch.
+// It is acknowledged in the queue, and its rescan jobs and span end with err.
+func (p *Plugin) dropEvent(dropped *pendingFileEvent, err error) {
+	p.metrics.CountEventDropped()
+	p.queue.done(dropped.event.Path, dropped.queueID, p.log)
+	for _, job := range dropped.jobs {
+		job.done(err)
+	}
+	dropped.endSpan(err)
+}
+
+// holdPendingEvent marks the pending event for path as held and appends the path
+// to held. When capacity distinct paths are already held, overflow decides
+// whether the oldest held event or the new one is dropped and returned.
+func holdPendingEvent(pending map[string]*pendingFileEvent, held []string, path string, capacity int, overflow string) ([]string, *pendingFileEvent) {
+	current, ok := pending[path]
+	if !ok || current.held {
+		return held, nil
+	}
+
+	// Held events may have been cancelled by a rename in the meantime.
+	held = slices.DeleteFunc(held, func(heldPath string) bool {
+		heldEvent, ok := pending[heldPath]
+		return !ok || !heldEvent.held
 	})
+
+	var dropped *pendingFileEvent
+	if len(held) >= capacity {
+		if overflow == OverflowDropNewest {
+			delete(pending, path)
+			return held, current
+		}
+		dropped = pending[held[0]]
+		delete(pending, held[0])
+		held = held[1:]
+	}
+
+	current.held = true
+	return append(held, path), dropped
+}
+
+// dispatchHeldEvents dispatches held events in the order they became ready until
+// everything is dispatched or dispatch is paused again.
+func (p *Plugin) dispatchHeldEvents(pending map[string]*pendingFileEvent, timers *eventTimers, held []string) []string {
+	for len(held) > 0 && !p.paused.Load() {
+		path := held[0]
+		held = held[1:]
+		p.held.Store(int64(len(held)))
+
+		pendingEvent, ok := pending[path]
+		if !ok || !pendingEvent.held {
+			continue
+		}
+		// A held file that was written again keeps waiting for its debounce timer.
+		if time.Now().Before(pendingEvent.fireAt) {
+			pendingEvent.held = false
+			continue
+		}
+
+		p.dispatchPendingEvent(pending, timers, pendingEvent)
+	}
+	return held
+}
+
+// opName returns the operation name sent to workers.
+func opName(op watcher.Op) string {
+	if op == opReplay {
+		return "REPLAY"
+	}
+	return op.String()
+}
+
+// isRenameEvent reports whether the event moved a file away from OldPath. The
+// watcher also fills OldPath for write events, where it equals Path.
+func isRenameEvent(event watcher.Event) bool {
+	return (event.Op == watcher.Rename || event.Op == watcher.Move) && event.OldPath != "" && event.OldPath != event.Path
 }
 
 func stopPendingEvents(pending map[string]*pendingFileEvent) {
 	for path, event := range pending {
-		if event.timer != nil {
-			event.timer.Stop()
-		}
+		event.endSpan(nil)
 		delete(pending, path)
 	}
 }
 
-func (p *Plugin) dispatchEvent(event watcher.Event) {
+// dispatchEvent sends the event to the target sink. The dispatch span is a child
+// of the span in ctx, if any.
+func (p *Plugin) dispatchEvent(ctx context.Context, event watcher.Event, target string, attempt int) (err error) {
 	start := time.Now().UTC()
 
-	eventDetails := map[string]interface{}{
-		"directory": p.watchedDirectoryForEvent(event.Path),
-		"file":      event.Name(),
-		"op":        event.Op.String(),
-		"path":      event.Path,
-		"eventTime": event.ModTime().String(),
-	}
+	done := p.inFlight.start(event, attempt, start)
+	p.metrics.AddInFlight(1)
+	defer func() {
+		p.metrics.AddInFlight(-1)
+		done()
+	}()
 
+	dir := p.watchedDirectoryForEvent(event.Path)
+
+	ctx, span := tracer().Start(ctx, spanDispatch, trace.WithAttributes(eventAttributes(dir, event)...), trace.WithAttributes(attribute.Int("file_watch.attempt", attempt), attribute.String("file_watch.target", target)))
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	eventDetails := newEventDetails(dir, event)
 	eventDetailsBytes, err := json.Marshal(eventDetails)
 	if err != nil {
 		p.log.Error("Failed to marshal event details", zap.Error(err))
-		return
+		return err
 	}
 
 	pld := payload.Payload{
@@ -165,25 +606,94 @@ func (p *Plugin) dispatchEvent(event watcher.Event) {
 
 	p.log.Debug("Sending event", zap.String("payload", pld.String()))
 
-	execErr := p.executePayload(&pld)
+	execCtx, execSpan := tracer().Start(ctx, spanWorkerExec)
+	// Workers read the W3C trace context from the payload context to continue the trace.
+	pld.Context = traceContext(execCtx)
+
+	execStart := time.Now()
+	_, execErr := p.executePayload(target, &pld, p.cfg.DispatchTimeout(target))
+	p.metrics.ObserveWorkerExec(time.Since(execStart))
+	endSpan(execSpan, execErr)
+	p.recordDispatch(dir, event, target, attempt, start, execErr)
+	return execErr
+}
+
+// newEventDetails returns the JSON object workers receive for an event.
+func newEventDetails(dir string, event watcher.Event) map[string]interface{} {
+	eventDetails := map[string]interface{}{
+		"directory": dir,
+		// Rename and move events carry the file info of the old path, so the name is
+		// taken from the event path instead of event.Name().
+		"file":      filepath.Base(event.Path),
+		"op":        opName(event.Op),
+		"path":      event.Path,
+		"eventTime": event.ModTime().String(),
+	}
+	if isRenameEvent(event) {
+		eventDetails["oldPath"] = event.OldPath
+	}
+	return eventDetails
+}
+
+// recordOutcome counts the outcome of one dispatch attempt of an event in the job
+// metrics and the error rate, once however many targets the event has.
+func (p *Plugin) recordOutcome(dir string, event watcher.Event, err error) {
+	p.errorRate.record(time.Now(), err != nil)
+	if err != nil {
+		p.metrics.CountJobErr(dir, opName(event.Op), failureReason(err))
+		return
+	}
+	p.metrics.CountJobOk(dir, opName(event.Op))
+}
+
+// recordDispatch counts the outcome of delivering the event to target in the
+// target metrics and the events bus.
+func (p *Plugin) recordDispatch(dir string, event watcher.Event, target string, attempt int, start time.Time, execErr error) {
+	eventOp := opName(event.Op)
 	if execErr != nil {
-		p.metrics.CountJobErr()
+		reason := failureReason(execErr)
+		p.metrics.CountTargetErr(dir, target, reason)
+		p.publish(&BusEvent{Kind: EventFileFailed, Dir: dir, Path: event.Path, Op: eventOp, Target: target, Attempt: attempt, Reason: reason, Error: execErr.Error()})
 
-		p.log.Error("notification processed with errors", zap.Error(execErr), zap.Time("start", start), zap.Int64("elapsed", time.Since(start).Milliseconds()))
+		p.log.Error("notification processed with errors", zap.Error(execErr), zap.String("path", event.Path), zap.String("target", target), zap.Int("attempt", attempt), zap.Time("start", start), zap.Int64("elapsed", time.Since(start).Milliseconds()))
 		return
 	}
 
-	p.metrics.CountJobOk()
+	p.metrics.CountTargetOk(dir, target)
+	p.publish(&BusEvent{Kind: EventFileDispatched, Dir: dir, Path: event.Path, Op: eventOp, Target: target, Attempt: attempt})
 
-	p.log.Debug("notification was processed successfully", zap.Time("start", start), zap.Int64("elapsed", time.Since(start).Milliseconds()))
+	p.log.Debug("notification was processed successfully", zap.String("path", event.Path), zap.String("target", target), zap.Int("attempt", attempt), zap.Time("start", start), zap.Int64("elapsed", time.Since(start).Milliseconds()))
 }
 
 func (p *Plugin) watchedDirectoryForEvent(path string) string {
+	if dir, ok := p.watchDirContaining(path); ok {
+		return dir
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.cfg.Dir != "" {
+		return p.cfg.Dir
+	}
+	dirs := p.cfg.WatchDirs()
+	if len(dirs) > 0 {
+		return dirs[0]
+	}
+	return ""
+}
+
+// watchDirContaining returns the watched directory that contains path.
+func (p *Plugin) watchDirContaining(path string) (string, bool) {
 	eventPath, err := filepath.Abs(path)
 	if err != nil {
 		eventPath = filepath.Clean(path)
 	}
 
+	// Watch directories can be changed at runtime through RPC.
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
 	for _, dir := range p.cfg.WatchDirs() {
 		watchDir, err := filepath.Abs(dir)
 		if err != nil {
@@ -191,42 +701,24 @@ func (p *Plugin) watchedDirectoryForEvent(path string) string {
 		}
 		rel, err := filepath.Rel(watchDir, eventPath)
 		if err == nil && rel != "." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && rel != ".." {
-			return dir
+			return dir, true
 		}
 		if err == nil && rel == "." {
-			return dir
+			return dir, true
 		}
 	}
-
-	if p.cfg.Dir != "" {
-		return p.cfg.Dir
-	}
-	dirs := p.cfg.WatchDirs()
-	if len(dirs) > 0 {
-		return dirs[0]
-	}
-	return ""
+	return "", false
 }
 
-func (p *Plugin) executePayload(pld *payload.Payload) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+// executePayload delivers the payload to the target sink within timeout and returns
+// its response. The outcome counts towards the circuit breaker of the sink.
+func (p *Plugin) executePayload(target string, pld *payload.Payload, timeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	// Protect from pool reset while Exec is using the pool.
-	p.mu.RLock()
-	pool := p.workersPool
-	if pool == nil {
-		p.mu.RUnlock()
-		return rrErrors.Str("worker pool is not initialized")
-	}
-	responses, execErr := pool.Exec(ctx, pld, nil)
-	p.mu.RUnlock()
-
-	if execErr != nil {
-		return execErr
-	}
-
-	return classifyWorkerResponse(ctx, responses)
+	response, err := p.sink(target).Deliver(ctx, pld)
+	p.recordCircuit(target, err)
+	return response, err
 }
 
 func classifyWorkerResponse(ctx context.Context, responses <-chan *static_pool.PExec) error {
@@ -235,7 +727,7 @@ func classifyWorkerResponse(ctx context.Context, responses <-chan *static_pool.P
 		return rrErrors.E(rrErrors.Op("file_watch_worker_response"), rrErrors.ExecTTL, ctx.Err())
 	case response, ok := <-responses:
 		if !ok {
-			return rrErrors.Str("worker returned no response")
+			return &dispatchFailure{reason: failureNoResponse, err: rrErrors.Str("worker returned no response")}
 		}
 		return classifyWorkerExecutionResponse(response)
 	}
@@ -248,7 +740,7 @@ type workerExecutionResponse interface {
 
 func classifyWorkerExecutionResponse(response workerExecutionResponse) error {
 	if response == nil {
-		return rrErrors.Str("worker returned nil response")
+		return &dispatchFailure{reason: failureNoResponse, err: rrErrors.Str("worker returned nil response")}
 	}
 	if err := response.Error(); err != nil {
 		return err
@@ -262,8 +754,52 @@ func classifyWorkerExecutionResponse(response workerExecutionResponse) error {
 	case workerResponseOK:
 		return nil
 	case workerResponseError:
-		return rrErrors.Str("worker returned ERROR")
+		return &dispatchFailure{reason: failureWorkerError, err: rrErrors.Str("worker returned ERROR")}
 	default:
-		return rrErrors.Errorf("worker returned unexpected response %q", string(body))
+		return &dispatchFailure{reason: failureUnexpectedResponse, err: rrErrors.Errorf("worker returned unexpected response %q", string(body))}
+	}
+}
+
+// Failure reasons exported by the jobs_failed_total metric.
+const (
+	failureTimeout            = "timeout"
+	failureTransport          = "transport"
+	failureWorkerError        = "worker_error"
+	failureUnexpectedResponse = "unexpected_response"
+	failureNoResponse         = "no_response"
+)
+
+// dispatchFailure tags a dispatch error with the reason exported in metrics.
+type dispatchFailure struct {
+	reason string
+	err    error
+	// permanent failures are not retried because another attempt would fail the same way.
+	permanent bool
+}
+
+func (f *dispatchFailure) Error() string {
+	return f.err.Error()
+}
+
+func (f *dispatchFailure) Unwrap() error {
+	return f.err
+}
+
+// failureReason returns the metrics reason for a dispatch error. Errors that were
+// not classified from the worker response come from the pool or the worker relay.
+func failureReason(err error) string {
+	var failure *dispatchFailure
+	if errors.As(err, &failure) {
+		return failure.reason
+	}
+	if rrErrors.Is(rrErrors.ExecTTL, err) || errors.Is(err, context.DeadlineExceeded) {
+		return failureTimeout
 	}
+	return failureTransport
+}
+
+// permanentFailure reports whether a dispatch error must not be retried.
+func permanentFailure(err error) bool {
+	var failure *dispatchFailure
+	return errors.As(err, &failure) && failure.permanent
 }
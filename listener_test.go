@@ -3,6 +3,7 @@ package roadrunner
 import (
 	"context"
 	"errors"
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/radovskyb/watcher"
 	"github.com/roadrunner-server/pool/pool/static_pool"
+	"go.uber.org/zap"
 )
 
 type fakeWorkerResponse struct {
@@ -96,11 +98,11 @@ func TestClassifyWorkerResponseContextDeadline(t *testing.T) {
 
 func TestScheduleDebouncedEventCoalescesByPath(t *testing.T) {
 	pending := make(map[string]*pendingFileEvent)
-	ready := make(chan debouncedFileEvent, 8)
+	timers := newEventTimers()
 
-	scheduleDebouncedEvent(pending, ready, watcher.Event{Path: "result.game", Op: watcher.Create}, 20*time.Millisecond)
-	scheduleDebouncedEvent(pending, ready, watcher.Event{Path: "result.game", Op: watcher.Write}, 20*time.Millisecond)
-	scheduleDebouncedEvent(pending, ready, watcher.Event{Path: "other.game", Op: watcher.Create}, 20*time.Millisecond)
+	scheduleDebouncedEvent(pending, timers, watcher.Event{Path: "result.game", Op: watcher.Create}, 20*time.Millisecond)
+	scheduleDebouncedEvent(pending, timers, watcher.Event{Path: "result.game", Op: watcher.Write}, 20*time.Millisecond)
+	scheduleDebouncedEvent(pending, timers, watcher.Event{Path: "other.game", Op: watcher.Create}, 20*time.Millisecond)
 
 	var resultReady debouncedFileEvent
 	var otherReady debouncedFileEvent
@@ -108,16 +110,18 @@ func TestScheduleDebouncedEventCoalescesByPath(t *testing.T) {
 
 	for resultReady.path == "" || otherReady.path == "" {
 		select {
-		case eventRef := <-ready:
-			pendingEvent := pending[eventRef.path]
-			if pendingEvent == nil || pendingEvent.seq != eventRef.seq {
-				continue
-			}
-			switch eventRef.path {
-			case "result.game":
-				resultReady = eventRef
-			case "other.game":
-				otherReady = eventRef
+		case <-timers.C:
+			for _, eventRef := range timers.due(time.Now()) {
+				pendingEvent := pending[eventRef.path]
+				if pendingEvent == nil || pendingEvent.seq != eventRef.seq {
+					continue
+				}
+				switch eventRef.path {
+				case "result.game":
+					resultReady = eventRef
+				case "other.game":
+					otherReady = eventRef
+				}
 			}
 		case <-deadline:
 			t.Fatal("timed out waiting for debounced events")
@@ -152,3 +156,230 @@ func TestWatchedDirectoryForEventFallsBackToLegacyDir(t *testing.T) {
 		t.Fatalf("expected legacy dir fallback, got %q", got)
 	}
 }
+
+func TestScheduleDebouncedEventCoalescesTempFileRenameIntoCreate(t *testing.T) {
+	pending := make(map[string]*pendingFileEvent)
+	timers := newEventTimers()
+
+	scheduleDebouncedEvent(pending, timers, watcher.Event{Path: "result.game.tmp", Op: watcher.Create}, time.Hour)
+	scheduleDebouncedEvent(pending, timers, watcher.Event{Path: "result.game.tmp", Op: watcher.Write}, time.Hour)
+	scheduleDebouncedEvent(pending, timers, watcher.Event{Path: "result.game", OldPath: "result.game.tmp", Op: watcher.Rename}, time.Hour)
+	defer stopPendingEvents(pending)
+
+	if _, ok := pending["result.game.tmp"]; ok {
+		t.Fatal("expected pending event for the temporary path to be cancelled")
+	}
+	final, ok := pending["result.game"]
+	if !ok {
+		t.Fatal("expected pending event for the final path")
+	}
+	if final.event.Op != watcher.Create {
+		t.Fatalf("expected renamed temporary file to be reported as CREATE, got %s", final.event.Op)
+	}
+	if final.event.OldPath != "" {
+		t.Fatalf("expected coalesced create to drop the old path, got %q", final.event.OldPath)
+	}
+	if final.detected.IsZero() || time.Since(final.detected) > time.Minute {
+		t.Fatalf("expected coalesced create to keep the detection time, got %s", final.detected)
+	}
+}
+
+func TestScheduleDebouncedEventKeepsRenameOfExistingFile(t *testing.T) {
+	pending := make(map[string]*pendingFileEvent)
+	timers := newEventTimers()
+
+	scheduleDebouncedEvent(pending, timers, watcher.Event{Path: "result.game", OldPath: "result.game", Op: watcher.Write}, time.Hour)
+	scheduleDebouncedEvent(pending, timers, watcher.Event{Path: "archive.game", OldPath: "result.game", Op: watcher.Rename}, time.Hour)
+	defer stopPendingEvents(pending)
+
+	if _, ok := pending["result.game"]; ok {
+		t.Fatal("expected pending event for the old path to be cancelled")
+	}
+	renamed, ok := pending["archive.game"]
+	if !ok {
+		t.Fatal("expected pending event for the new path")
+	}
+	if renamed.event.Op != watcher.Rename || renamed.event.OldPath != "result.game" {
+		t.Fatalf("expected RENAME from result.game, got %s from %q", renamed.event.Op, renamed.event.OldPath)
+	}
+}
+
+func TestHoldPendingEventCoalescesByPath(t *testing.T) {
+	pending := make(map[string]*pendingFileEvent)
+
+	queueEvent(pending, watcher.Event{Path: "result.game", Op: watcher.Create})
+	held, dropped := holdPendingEvent(pending, nil, "result.game", 2, OverflowDropOldest)
+	queueEvent(pending, watcher.Event{Path: "result.game", Op: watcher.Write})
+	held, _ = holdPendingEvent(pending, held, "result.game", 2, OverflowDropOldest)
+
+	if dropped != nil {
+		t.Fatalf("expected nothing to be dropped, got %q", dropped.event.Path)
+	}
+	if len(held) != 1 || held[0] != "result.game" {
+		t.Fatalf("expected one held path, got %#v", held)
+	}
+	if got := pending["result.game"].event.Op; got != watcher.Write {
+		t.Fatalf("expected latest held event to be WRITE, got %s", got)
+	}
+}
+
+func TestHoldPendingEventDropsOldestWhenFull(t *testing.T) {
+	pending := make(map[string]*pendingFileEvent)
+
+	var held []string
+	var dropped *pendingFileEvent
+	for _, path := range []string{"first.game", "second.game", "third.game"} {
+		queueEvent(pending, watcher.Event{Path: path})
+		held, dropped = holdPendingEvent(pending, held, path, 2, OverflowDropOldest)
+	}
+
+	if dropped == nil || dropped.event.Path != "first.game" {
+		t.Fatalf("expected oldest event to be dropped, got %#v", dropped)
+	}
+	if len(held) != 2 || held[0] != "second.game" || held[1] != "third.game" {
+		t.Fatalf("unexpected held paths %#v", held)
+	}
+	if _, ok := pending["first.game"]; ok {
+		t.Fatal("expected dropped event to be removed from pending")
+	}
+}
+
+func TestHoldPendingEventDropsNewestWhenFull(t *testing.T) {
+	pending := make(map[string]*pendingFileEvent)
+
+	var held []string
+	var dropped *pendingFileEvent
+	for _, path := range []string{"first.game", "second.game"} {
+		queueEvent(pending, watcher.Event{Path: path})
+		held, dropped = holdPendingEvent(pending, held, path, 1, OverflowDropNewest)
+	}
+
+	if dropped == nil || dropped.event.Path != "second.game" {
+		t.Fatalf("expected new event to be dropped, got %#v", dropped)
+	}
+	if len(held) != 1 || held[0] != "first.game" {
+		t.Fatalf("unexpected held paths %#v", held)
+	}
+	if _, ok := pending["second.game"]; ok {
+		t.Fatal("expected dropped event not to be pending")
+	}
+}
+
+func TestHoldPendingEventSkipsCancelledEventsWhenCounting(t *testing.T) {
+	pending := make(map[string]*pendingFileEvent)
+
+	queueEvent(pending, watcher.Event{Path: "result.game.tmp"})
+	held, _ := holdPendingEvent(pending, nil, "result.game.tmp", 1, OverflowDropNewest)
+	delete(pending, "result.game.tmp")
+	queueEvent(pending, watcher.Event{Path: "result.game"})
+	held, dropped := holdPendingEvent(pending, held, "result.game", 1, OverflowDropNewest)
+
+	if dropped != nil {
+		t.Fatalf("expected cancelled event to free its slot, got dropped %q", dropped.event.Path)
+	}
+	if len(held) != 1 || held[0] != "result.game" {
+		t.Fatalf("unexpected held paths %#v", held)
+	}
+}
+
+func TestDispatchPendingEventSchedulesRetryWithBackoff(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "result.game")
+	if err := os.WriteFile(path, []byte("content"), 0644); err != nil {
+		t.Fatalf("failed to write result file: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat result file: %v", err)
+	}
+
+	// Without a worker pool every dispatch fails.
+	p := &Plugin{cfg: &Config{MaxAttempts: 2, RetryBackoff: "1h"}, log: zap.NewNop()}
+	p.metrics = newStatsExporter(p, nil)
+	pending := make(map[string]*pendingFileEvent)
+	timers := newEventTimers()
+	job := &rescanJob{total: 1}
+
+	pendingEvent := queueEvent(pending, watcher.Event{Path: path, Op: opReplay, FileInfo: info})
+	pendingEvent.jobs = append(pendingEvent.jobs, job)
+	p.pendingMu.Lock()
+	defer p.pendingMu.Unlock()
+	p.dispatchPendingEvent(pending, timers, pendingEvent)
+	defer stopPendingEvents(pending)
+
+	retry, ok := pending[path]
+	if !ok {
+		t.Fatal("expected failed event to be scheduled again")
+	}
+	if retry.attempt != 1 {
+		t.Fatalf("expected one failed attempt, got %d", retry.attempt)
+	}
+	if wait := time.Until(retry.fireAt); wait < 59*time.Minute {
+		t.Fatalf("expected retry after the backoff, got %s", wait)
+	}
+	if job.failed.Load() != 0 {
+		t.Fatal("expected job to wait for the retry")
+	}
+
+	p.dispatchPendingEvent(pending, timers, retry)
+	if _, ok := pending[path]; ok {
+		t.Fatal("expected event to be given up after max_attempts")
+	}
+	if job.failed.Load() != 1 {
+		t.Fatalf("expected job to record the failure, got %d", job.failed.Load())
+	}
+}
+
+func TestFailureReasonClassifiesWorkerResponses(t *testing.T) {
+	closed := make(chan *static_pool.PExec)
+	close(closed)
+	cancelled, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	cases := map[string]error{
+		failureWorkerError:        classifyWorkerExecutionResponse(fakeWorkerResponse{body: []byte("ERROR")}),
+		failureUnexpectedResponse: classifyWorkerExecutionResponse(fakeWorkerResponse{body: []byte("MAYBE")}),
+		failureNoResponse:         classifyWorkerResponse(t.Context(), closed),
+		failureTransport:          classifyWorkerExecutionResponse(fakeWorkerResponse{err: errors.New("relay closed")}),
+		failureTimeout:            classifyWorkerResponse(cancelled, make(chan *static_pool.PExec)),
+	}
+	for expected, err := range cases {
+		if got := failureReason(err); got != expected {
+			t.Fatalf("expected reason %s for %v, got %s", expected, err, got)
+		}
+	}
+}
+
+func TestUpdateQueueMetricsCountsPendingRetriesAndDeadLetters(t *testing.T) {
+	p := &Plugin{}
+	p.metrics = newStatsExporter(p, nil)
+
+	detected := time.Now().Add(-time.Minute)
+	pending := map[string]*pendingFileEvent{
+		"new.game":   {detected: time.Now(), seq: 1},
+		"retry.game": {detected: detected, attempt: 2},
+	}
+	timers := newEventTimers()
+	timers.schedule("new.game", 1, time.Now().Add(-time.Second))
+	timers.schedule("retry.game", 1, time.Now().Add(time.Minute))
+
+	p.recordDeadLetter("failed.game", errors.New("worker returned ERROR"))
+	p.recordDeadLetter("recovered.game", errors.New("worker returned ERROR"))
+	p.recordDeadLetter("recovered.game", nil)
+	p.updateQueueMetrics(pending, timers)
+
+	if got := *p.metrics.pending; got != 1 {
+		t.Fatalf("expected one debouncing event, got %d", got)
+	}
+	if got := *p.metrics.retrying; got != 1 {
+		t.Fatalf("expected one retry, got %d", got)
+	}
+	if got := *p.metrics.waiting; got != 1 {
+		t.Fatalf("expected one waiting event, got %d", got)
+	}
+	if got := *p.metrics.deadLettered; got != 1 {
+		t.Fatalf("expected one dead-lettered file, got %d", got)
+	}
+	if got := *p.metrics.oldestPendingNs; got != detected.UnixNano() {
+		t.Fatalf("expected oldest pending event to be the retry, got %d", got)
+	}
+}
@@ -2,7 +2,9 @@ package roadrunner
 
 import (
 	"strconv"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/roadrunner-server/pool/fsm"
@@ -13,35 +15,243 @@ const (
 )
 
 type statsExporter struct {
-	events  *uint64
-	jobsOk  *uint64
-	jobsErr *uint64
-
+	events        *uint64
+	jobsOk        *uint64
+	jobsErr       *uint64
+	eventsDropped *uint64
+	paused        *uint64
+	// spilled and overflowBlocked describe a full pending queue.
+	spilled         *uint64
+	overflowBlocked *uint64
+
+	// The unlabelled events, jobs_ok and jobs_err gauges are only exported with
+	// legacy_metrics enabled.
+	legacy      bool
 	eventsDesc  *prometheus.Desc
 	jobsErrDesc *prometheus.Desc
 	jobsOkDesc  *prometheus.Desc
 
+	eventsTotal     *prometheus.CounterVec
+	jobsOkTotal     *prometheus.CounterVec
+	jobsFailedTotal *prometheus.CounterVec
+
+	// Deliveries to the targets of a watch, by target sink.
+	targetOkTotal      *prometheus.CounterVec
+	targetFailedTotal  *prometheus.CounterVec
+	targetGivenUpTotal *prometheus.CounterVec
+
+	// rateLimitedTotal counts events held back by a rate limit.
+	rateLimitedTotal *prometheus.CounterVec
+
+	// Circuit breaker state and openings, by target sink.
+	circuitState       *prometheus.GaugeVec
+	circuitOpenedTotal *prometheus.CounterVec
+
+	// overflowTotal counts new files that found the pending queue full, by policy.
+	overflowTotal *prometheus.CounterVec
+
+	eventsDroppedDesc   *prometheus.Desc
+	pausedDesc          *prometheus.Desc
+	spilledDesc         *prometheus.Desc
+	overflowBlockedDesc *prometheus.Desc
+
+	// Queue gauges published by the event loop after every iteration.
+	pending         *uint64
+	waiting         *uint64
+	inFlight        *int64
+	retrying        *uint64
+	deadLettered    *uint64
+	oldestPendingNs *int64
+
+	pendingDesc          *prometheus.Desc
+	waitingDesc          *prometheus.Desc
+	inFlightDesc         *prometheus.Desc
+	retryingDesc         *prometheus.Desc
+	deadLetteredDesc     *prometheus.Desc
+	oldestPendingAgeDesc *prometheus.Desc
+
+	// endToEndLatency measures from file detection to a successful worker response,
+	// debounceWait from file detection to the first dispatch attempt, and
+	// workerExec the duration of a single worker execution.
+	endToEndLatency prometheus.Histogram
+	debounceWait    prometheus.Histogram
+	workerExec      prometheus.Histogram
+
+	// watchDirs holds the state of every configured watch directory.
+	watchDirsMu     sync.Mutex
+	watchDirs       map[string]*watchDirState
+	watchDirUpDesc  *prometheus.Desc
+	lastEventDesc   *prometheus.Desc
+	lastSuccessDesc *prometheus.Desc
+
 	defaultExporter *StatsExporter
 }
 
+// watchDirState is the state of a configured watch directory. Zero times mean
+// that nothing happened yet.
+type watchDirState struct {
+	up bool
+	// since is when the directory was first registered.
+	since       time.Time
+	lastEvent   time.Time
+	lastSuccess time.Time
+}
+
 func (p *Plugin) MetricsCollector() []prometheus.Collector {
 	// p - implements Exporter interface (workers)
 	return []prometheus.Collector{p.metrics}
 }
 
-func (se *statsExporter) CountJobOk() {
+func (se *statsExporter) CountJobOk(dir, op string) {
 	atomic.AddUint64(se.jobsOk, 1)
+	se.jobsOkTotal.WithLabelValues(dir, op).Inc()
+
+	se.watchDirsMu.Lock()
+	if state, ok := se.watchDirs[dir]; ok {
+		state.lastSuccess = time.Now()
+	}
+	se.watchDirsMu.Unlock()
 }
 
-func (se *statsExporter) CountJobErr() {
+func (se *statsExporter) CountJobErr(dir, op, reason string) {
 	atomic.AddUint64(se.jobsErr, 1)
+	se.jobsFailedTotal.WithLabelValues(dir, op, reason).Inc()
+}
+
+func (se *statsExporter) CountTargetOk(dir, target string) {
+	se.targetOkTotal.WithLabelValues(dir, target).Inc()
+}
+
+func (se *statsExporter) CountTargetErr(dir, target, reason string) {
+	se.targetFailedTotal.WithLabelValues(dir, target, reason).Inc()
+}
+
+func (se *statsExporter) CountTargetGivenUp(dir, target string) {
+	se.targetGivenUpTotal.WithLabelValues(dir, target).Inc()
+}
+
+func (se *statsExporter) CountRateLimited(dir string) {
+	se.rateLimitedTotal.WithLabelValues(dir).Inc()
+}
+
+func (se *statsExporter) SetCircuitState(target string, state circuitState) {
+	se.circuitState.WithLabelValues(target).Set(float64(state))
+}
+
+func (se *statsExporter) CountCircuitOpened(target string) {
+	se.circuitOpenedTotal.WithLabelValues(target).Inc()
+}
+
+func (se *statsExporter) CountOverflow(policy string) {
+	se.overflowTotal.WithLabelValues(policy).Inc()
+}
+
+func (se *statsExporter) SetSpilled(spilled int) {
+	atomic.StoreUint64(se.spilled, uint64(spilled))
 }
 
-func (se *statsExporter) CountEvents() {
+func (se *statsExporter) SetOverflowBlocked(blocked bool) {
+	var value uint64
+	if blocked {
+		value = 1
+	}
+	atomic.StoreUint64(se.overflowBlocked, value)
+}
+
+func (se *statsExporter) CountEvents(dir, op string) {
 	atomic.AddUint64(se.events, 1)
+	se.eventsTotal.WithLabelValues(dir, op).Inc()
+
+	se.watchDirsMu.Lock()
+	if state, ok := se.watchDirs[dir]; ok {
+		state.lastEvent = time.Now()
+	}
+	se.watchDirsMu.Unlock()
+}
+
+func (se *statsExporter) ObserveEndToEnd(d time.Duration) {
+	se.endToEndLatency.Observe(d.Seconds())
+}
+
+func (se *statsExporter) ObserveDebounceWait(d time.Duration) {
+	se.debounceWait.Observe(d.Seconds())
+}
+
+func (se *statsExporter) ObserveWorkerExec(d time.Duration) {
+	se.workerExec.Observe(d.Seconds())
 }
 
-func newStatsExporter(stats Informer) *statsExporter {
+func (se *statsExporter) CountEventDropped() {
+	atomic.AddUint64(se.eventsDropped, 1)
+}
+
+func (se *statsExporter) SetPaused(paused bool) {
+	var value uint64
+	if paused {
+		value = 1
+	}
+	atomic.StoreUint64(se.paused, value)
+}
+
+// SetQueue records the state of the event loop queue. oldestPending is the
+// detection time of the oldest pending event, zero when nothing is pending.
+func (se *statsExporter) SetQueue(pending, waiting, retrying, deadLettered int, oldestPending time.Time) {
+	atomic.StoreUint64(se.pending, uint64(pending))
+	atomic.StoreUint64(se.waiting, uint64(waiting))
+	atomic.StoreUint64(se.retrying, uint64(retrying))
+	atomic.StoreUint64(se.deadLettered, uint64(deadLettered))
+
+	var oldest int64
+	if !oldestPending.IsZero() {
+		oldest = oldestPending.UnixNano()
+	}
+	atomic.StoreInt64(se.oldestPendingNs, oldest)
+}
+
+func (se *statsExporter) AddInFlight(delta int64) {
+	atomic.AddInt64(se.inFlight, delta)
+}
+
+// SetWatchDir records whether a configured watch directory is currently watched.
+func (se *statsExporter) SetWatchDir(dir string, up bool) {
+	se.watchDirsMu.Lock()
+	defer se.watchDirsMu.Unlock()
+	if state, ok := se.watchDirs[dir]; ok {
+		state.up = up
+		return
+	}
+	se.watchDirs[dir] = &watchDirState{up: up, since: time.Now()}
+}
+
+// RemoveWatchDir stops exporting a directory that is no longer configured.
+func (se *statsExporter) RemoveWatchDir(dir string) {
+	se.watchDirsMu.Lock()
+	defer se.watchDirsMu.Unlock()
+	delete(se.watchDirs, dir)
+}
+
+// WatchDirActivity returns when the directory was registered and when it last
+// received a file event. ok is false for directories that are not configured.
+func (se *statsExporter) WatchDirActivity(dir string) (since, lastEvent time.Time, ok bool) {
+	se.watchDirsMu.Lock()
+	defer se.watchDirsMu.Unlock()
+	state, ok := se.watchDirs[dir]
+	if !ok {
+		return time.Time{}, time.Time{}, false
+	}
+	return state.since, state.lastEvent, true
+}
+
+func newStatsExporter(stats Informer, cfg *Config) *statsExporter {
+	latencyBuckets := prometheus.DefBuckets
+	var legacy bool
+	if cfg != nil {
+		if len(cfg.LatencyBuckets) > 0 {
+			latencyBuckets = cfg.LatencyBuckets
+		}
+		legacy = cfg.LegacyMetrics
+	}
+
 	return &statsExporter{
 		defaultExporter: &StatsExporter{
 			TotalWorkersDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "total_workers"), "Total number of workers used by the plugin", nil, nil),
@@ -56,22 +266,149 @@ func newStatsExporter(stats Informer) *statsExporter {
 			Workers: stats,
 		},
 
-		events:  toPtr(uint64(0)),
-		jobsOk:  toPtr(uint64(0)),
-		jobsErr: toPtr(uint64(0)),
-
+		events:          toPtr(uint64(0)),
+		jobsOk:          toPtr(uint64(0)),
+		jobsErr:         toPtr(uint64(0)),
+		eventsDropped:   toPtr(uint64(0)),
+		paused:          toPtr(uint64(0)),
+		spilled:         toPtr(uint64(0)),
+		overflowBlocked: toPtr(uint64(0)),
+
+		pending:         toPtr(uint64(0)),
+		waiting:         toPtr(uint64(0)),
+		inFlight:        toPtr(int64(0)),
+		retrying:        toPtr(uint64(0)),
+		deadLettered:    toPtr(uint64(0)),
+		oldestPendingNs: toPtr(int64(0)),
+
+		pendingDesc:          prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "pending_events"), "Events waiting for their debounce window, including events held while paused", nil, nil),
+		waitingDesc:          prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "waiting_events"), "Events whose debounce or retry timer fired and that wait for the event loop to dispatch them", nil, nil),
+		inFlightDesc:         prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "in_flight_dispatches"), "Dispatches currently executed by workers", nil, nil),
+		retryingDesc:         prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "retry_scheduled_events"), "Failed events scheduled for another attempt", nil, nil),
+		deadLetteredDesc:     prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "dead_lettered_files"), "Files whose last dispatch attempt failed and that were given up", nil, nil),
+		oldestPendingAgeDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "oldest_pending_event_age_seconds"), "Time since the oldest pending event was detected, 0 when nothing is pending", nil, nil),
+
+		legacy:      legacy,
 		eventsDesc:  prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "events"), "Number of events registered in the directory", nil, nil),
 		jobsErrDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "jobs_err"), "Number of notifications error while processing in the worker", nil, nil),
 		jobsOkDesc:  prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "jobs_ok"), "Number of successfully processed notifications", nil, nil),
+
+		eventsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "events_total",
+			Help:      "Number of filesystem events received, by watch directory and op",
+		}, []string{"dir", "op"}),
+		jobsOkTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "jobs_ok_total",
+			Help:      "Number of dispatches the worker answered with OK, by watch directory and op",
+		}, []string{"dir", "op"}),
+		jobsFailedTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "jobs_failed_total",
+			Help:      "Number of failed dispatches, by watch directory, op and failure reason",
+		}, []string{"dir", "op", "reason"}),
+		targetOkTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "target_ok_total",
+			Help:      "Number of successful deliveries, by watch directory and target sink",
+		}, []string{"dir", "target"}),
+		targetFailedTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "target_failed_total",
+			Help:      "Number of failed delivery attempts, by watch directory, target sink and failure reason",
+		}, []string{"dir", "target", "reason"}),
+		targetGivenUpTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "target_given_up_total",
+			Help:      "Number of events a target sink was given up for after its last attempt failed",
+		}, []string{"dir", "target"}),
+		rateLimitedTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limited_total",
+			Help:      "Number of events held back by the global or the watch rate limit, by watch directory",
+		}, []string{"dir"}),
+		circuitState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "circuit_state",
+			Help:      "State of the circuit breaker of a target sink: 0 closed, 1 half-open, 2 open",
+		}, []string{"target"}),
+		circuitOpenedTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "circuit_opened_total",
+			Help:      "Number of times the circuit breaker of a target sink opened",
+		}, []string{"target"}),
+		overflowTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "overflow_total",
+			Help:      "Number of new files that found the pending queue full, by overflow policy",
+		}, []string{"policy"}),
+
+		eventsDroppedDesc:   prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "events_dropped_total"), "Number of events dropped because the pause buffer or the pending queue was full", nil, nil),
+		pausedDesc:          prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "paused"), "Whether event dispatch is paused through RPC", nil, nil),
+		spilledDesc:         prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "spilled_events"), "Events spilled to disk until the pending queue has room for them", nil, nil),
+		overflowBlockedDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "overflow_blocked"), "Whether the event loop stopped reading file events until the pending queue has room", nil, nil),
+
+		endToEndLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "end_to_end_latency_seconds",
+			Help:      "Time from detecting a file event to a successful worker response",
+			Buckets:   latencyBuckets,
+		}),
+		debounceWait: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "debounce_wait_seconds",
+			Help:      "Time from detecting a file event to its first dispatch attempt",
+			Buckets:   latencyBuckets,
+		}),
+		workerExec: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "worker_exec_seconds",
+			Help:      "Duration of a single worker execution",
+			Buckets:   latencyBuckets,
+		}),
+
+		watchDirs:       make(map[string]*watchDirState),
+		watchDirUpDesc:  prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "watch_dir_up"), "Whether a configured watch directory exists and is being watched", []string{"dir"}, nil),
+		lastEventDesc:   prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "last_event_timestamp_seconds"), "Unix time of the last filesystem event received in a watch directory", []string{"dir"}, nil),
+		lastSuccessDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "last_success_timestamp_seconds"), "Unix time of the last dispatch from a watch directory the worker answered with OK", []string{"dir"}, nil),
 	}
 }
 
 func (se *statsExporter) Describe(d chan<- *prometheus.Desc) {
 	// send description
 	se.defaultExporter.Describe(d)
-	d <- se.eventsDesc
-	d <- se.jobsErrDesc
-	d <- se.jobsOkDesc
+	if se.legacy {
+		d <- se.eventsDesc
+		d <- se.jobsErrDesc
+		d <- se.jobsOkDesc
+	}
+	se.eventsTotal.Describe(d)
+	se.jobsOkTotal.Describe(d)
+	se.jobsFailedTotal.Describe(d)
+	se.targetOkTotal.Describe(d)
+	se.targetFailedTotal.Describe(d)
+	se.targetGivenUpTotal.Describe(d)
+	se.rateLimitedTotal.Describe(d)
+	se.circuitState.Describe(d)
+	se.circuitOpenedTotal.Describe(d)
+	se.overflowTotal.Describe(d)
+	d <- se.eventsDroppedDesc
+	d <- se.pausedDesc
+	d <- se.spilledDesc
+	d <- se.overflowBlockedDesc
+	d <- se.pendingDesc
+	d <- se.waitingDesc
+	d <- se.inFlightDesc
+	d <- se.retryingDesc
+	d <- se.deadLetteredDesc
+	d <- se.oldestPendingAgeDesc
+	d <- se.watchDirUpDesc
+	d <- se.lastEventDesc
+	d <- se.lastSuccessDesc
+	se.endToEndLatency.Describe(d)
+	se.debounceWait.Describe(d)
+	se.workerExec.Describe(d)
 }
 
 func (se *statsExporter) Collect(ch chan<- prometheus.Metric) {
@@ -79,9 +416,62 @@ func (se *statsExporter) Collect(ch chan<- prometheus.Metric) {
 	se.defaultExporter.Collect(ch)
 
 	// send the values to the prometheus
-	ch <- prometheus.MustNewConstMetric(se.jobsOkDesc, prometheus.GaugeValue, float64(atomic.LoadUint64(se.jobsOk)))
-	ch <- prometheus.MustNewConstMetric(se.jobsErrDesc, prometheus.GaugeValue, float64(atomic.LoadUint64(se.jobsErr)))
-	ch <- prometheus.MustNewConstMetric(se.eventsDesc, prometheus.GaugeValue, float64(atomic.LoadUint64(se.events)))
+	if se.legacy {
+		ch <- prometheus.MustNewConstMetric(se.jobsOkDesc, prometheus.GaugeValue, float64(atomic.LoadUint64(se.jobsOk)))
+		ch <- prometheus.MustNewConstMetric(se.jobsErrDesc, prometheus.GaugeValue, float64(atomic.LoadUint64(se.jobsErr)))
+		ch <- prometheus.MustNewConstMetric(se.eventsDesc, prometheus.GaugeValue, float64(atomic.LoadUint64(se.events)))
+	}
+	se.eventsTotal.Collect(ch)
+	se.jobsOkTotal.Collect(ch)
+	se.jobsFailedTotal.Collect(ch)
+	se.targetOkTotal.Collect(ch)
+	se.targetFailedTotal.Collect(ch)
+	se.targetGivenUpTotal.Collect(ch)
+	se.rateLimitedTotal.Collect(ch)
+	se.circuitState.Collect(ch)
+	se.circuitOpenedTotal.Collect(ch)
+	se.overflowTotal.Collect(ch)
+	ch <- prometheus.MustNewConstMetric(se.eventsDroppedDesc, prometheus.CounterValue, float64(atomic.LoadUint64(se.eventsDropped)))
+	ch <- prometheus.MustNewConstMetric(se.pausedDesc, prometheus.GaugeValue, float64(atomic.LoadUint64(se.paused)))
+	ch <- prometheus.MustNewConstMetric(se.spilledDesc, prometheus.GaugeValue, float64(atomic.LoadUint64(se.spilled)))
+	ch <- prometheus.MustNewConstMetric(se.overflowBlockedDesc, prometheus.GaugeValue, float64(atomic.LoadUint64(se.overflowBlocked)))
+
+	ch <- prometheus.MustNewConstMetric(se.pendingDesc, prometheus.GaugeValue, float64(atomic.LoadUint64(se.pending)))
+	ch <- prometheus.MustNewConstMetric(se.waitingDesc, prometheus.GaugeValue, float64(atomic.LoadUint64(se.waiting)))
+	ch <- prometheus.MustNewConstMetric(se.inFlightDesc, prometheus.GaugeValue, float64(atomic.LoadInt64(se.inFlight)))
+	ch <- prometheus.MustNewConstMetric(se.retryingDesc, prometheus.GaugeValue, float64(atomic.LoadUint64(se.retrying)))
+	ch <- prometheus.MustNewConstMetric(se.deadLetteredDesc, prometheus.GaugeValue, float64(atomic.LoadUint64(se.deadLettered)))
+
+	var oldestAge float64
+	if oldest := atomic.LoadInt64(se.oldestPendingNs); oldest != 0 {
+		oldestAge = time.Since(time.Unix(0, oldest)).Seconds()
+	}
+	ch <- prometheus.MustNewConstMetric(se.oldestPendingAgeDesc, prometheus.GaugeValue, oldestAge)
+
+	se.watchDirsMu.Lock()
+	for dir, state := range se.watchDirs {
+		var value float64
+		if state.up {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(se.watchDirUpDesc, prometheus.GaugeValue, value, dir)
+		// Timestamps are only exported once something happened in the directory.
+		if !state.lastEvent.IsZero() {
+			ch <- prometheus.MustNewConstMetric(se.lastEventDesc, prometheus.GaugeValue, unixSeconds(state.lastEvent), dir)
+		}
+		if !state.lastSuccess.IsZero() {
+			ch <- prometheus.MustNewConstMetric(se.lastSuccessDesc, prometheus.GaugeValue, unixSeconds(state.lastSuccess), dir)
+		}
+	}
+	se.watchDirsMu.Unlock()
+
+	se.endToEndLatency.Collect(ch)
+	se.debounceWait.Collect(ch)
+	se.workerExec.Collect(ch)
+}
+
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
 }
 
 func toPtr[T any](v T) *T {
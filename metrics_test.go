@@ -0,0 +1,79 @@
+package roadrunner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestStatsExporterCollectsLatencyHistograms(t *testing.T) {
+	p := &Plugin{}
+	p.metrics = newStatsExporter(p, &Config{LatencyBuckets: []float64{1, 5}})
+
+	p.metrics.ObserveEndToEnd(2 * time.Second)
+	p.metrics.ObserveDebounceWait(time.Second)
+	p.metrics.ObserveWorkerExec(100 * time.Millisecond)
+
+	for _, name := range []string{
+		"rr_file_watch_end_to_end_latency_seconds",
+		"rr_file_watch_debounce_wait_seconds",
+		"rr_file_watch_worker_exec_seconds",
+	} {
+		if count := testutil.CollectAndCount(p.metrics, name); count != 1 {
+			t.Fatalf("expected %s to be collected once, got %d", name, count)
+		}
+	}
+}
+
+func TestStatsExporterLabelsJobsByDirOpAndReason(t *testing.T) {
+	p := &Plugin{}
+	p.metrics = newStatsExporter(p, nil)
+
+	p.metrics.CountEvents("./lmx/results", "CREATE")
+	p.metrics.CountJobOk("./lmx/results", "CREATE")
+	p.metrics.CountJobErr("./lmx/results", "WRITE", failureTimeout)
+
+	if got := testutil.ToFloat64(p.metrics.jobsFailedTotal.WithLabelValues("./lmx/results", "WRITE", failureTimeout)); got != 1 {
+		t.Fatalf("expected one timed out job, got %v", got)
+	}
+	if count := testutil.CollectAndCount(p.metrics, "rr_file_watch_jobs_ok"); count != 0 {
+		t.Fatal("expected legacy metrics to be disabled by default")
+	}
+}
+
+func TestStatsExporterKeepsLegacyMetricsBehindFlag(t *testing.T) {
+	p := &Plugin{}
+	p.metrics = newStatsExporter(p, &Config{LegacyMetrics: true})
+
+	p.metrics.CountEvents("./lmx/results", "CREATE")
+
+	if count := testutil.CollectAndCount(p.metrics, "rr_file_watch_events"); count != 1 {
+		t.Fatalf("expected legacy events gauge to be exported, got %d", count)
+	}
+	if count := testutil.CollectAndCount(p.metrics, "rr_file_watch_events_total"); count != 1 {
+		t.Fatalf("expected labelled events counter to be exported, got %d", count)
+	}
+}
+
+func TestStatsExporterExportsWatchDirTimestamps(t *testing.T) {
+	p := &Plugin{}
+	p.metrics = newStatsExporter(p, nil)
+	p.metrics.SetWatchDir("./lmx/results", true)
+
+	if count := testutil.CollectAndCount(p.metrics, "rr_file_watch_last_event_timestamp_seconds"); count != 0 {
+		t.Fatalf("expected no last event timestamp before the first event, got %d", count)
+	}
+
+	p.metrics.CountEvents("./lmx/results", "CREATE")
+	p.metrics.CountJobOk("./lmx/results", "CREATE")
+
+	for _, name := range []string{
+		"rr_file_watch_last_event_timestamp_seconds",
+		"rr_file_watch_last_success_timestamp_seconds",
+	} {
+		if count := testutil.CollectAndCount(p.metrics, name); count != 1 {
+			t.Fatalf("expected %s to be collected once, got %d", name, count)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package roadrunner
+
+import (
+	"path/filepath"
+	"regexp"
+)
+
+// orderedDispatch runs dispatches in parallel while events that share an ordering
+// key are dispatched one after another in the order they became ready. It is owned
+// by the event loop and guarded by pendingMu; waiting events stay in pending until
+// they are dispatched.
+type orderedDispatch struct {
+	key         string
+	pattern     *regexp.Regexp
+	parallelism int
+	// waiting lists the ready events in the order they became ready.
+	waiting []orderedEntry
+	// running holds the keys with a dispatch in progress.
+	running map[string]struct{}
+	// retrying holds the keys of failed events waiting for their retry. Later
+	// events of such a key wait until the failed one is done.
+	retrying map[string]*pendingFileEvent
+	// done receives finished dispatches. It holds one result per running key, so
+	// dispatches never block on it.
+	done chan orderedResult
+}
+
+// orderedEntry is a waiting event and its seq when it became ready. A later change
+// of the file restarts its debounce timer and leaves the entry stale.
+type orderedEntry struct {
+	event *pendingFileEvent
+	seq   uint64
+	key   string
+}
+
+// orderedResult is a finished dispatch.
+type orderedResult struct {
+	event *pendingFileEvent
+	dir   string
+	key   string
+}
+
+func newOrderedDispatch(key string, pattern *regexp.Regexp, parallelism int) *orderedDispatch {
+	return &orderedDispatch{
+		key:         key,
+		pattern:     pattern,
+		parallelism: parallelism,
+		running:     make(map[string]struct{}),
+		retrying:    make(map[string]*pendingFileEvent),
+		done:        make(chan orderedResult, parallelism),
+	}
+}
+
+// eventKey returns the ordering key of an event for path in the watched directory dir.
+func (o *orderedDispatch) eventKey(dir, path string) string {
+	switch o.key {
+	case OrderDir:
+		return dir
+	case OrderPattern:
+		if match := o.pattern.FindStringSubmatch(filepath.Base(path)); match != nil {
+			return match[1]
+		}
+	}
+	return path
+}
+
+// orderEvent queues a ready event and starts the dispatches that are free to run.
+// The caller must hold pendingMu.
+func (p *Plugin) orderEvent(pending map[string]*pendingFileEvent, pendingEvent *pendingFileEvent) {
+	o := p.ordered
+	pendingEvent.held = false
+	key := o.eventKey(p.watchedDirectoryForEvent(pendingEvent.event.Path), pendingEvent.event.Path)
+	o.waiting = append(o.waiting, orderedEntry{event: pendingEvent, seq: pendingEvent.seq, key: key})
+	p.startOrdered(pending)
+}
+
+// startOrdered dispatches waiting events whose key is idle, oldest first, until
+// parallelism dispatches run. Nothing starts while dispatch is paused. The caller
+// must hold pendingMu.
+func (p *Plugin) startOrdered(pending map[string]*pendingFileEvent) {
+	o := p.ordered
+	if p.paused.Load() {
+		return
+	}
+
+	waiting := make([]orderedEntry, 0, len(o.waiting))
+	for _, entry := range o.waiting {
+		current, ok := pending[entry.event.event.Path]
+		if !ok || current != entry.event || current.seq != entry.seq {
+			continue
+		}
+		if o.busy(pending, entry) || len(o.running) >= o.parallelism {
+			waiting = append(waiting, entry)
+			continue
+		}
+
+		delete(o.retrying, entry.key)
+		o.running[entry.key] = struct{}{}
+		dir := p.startDispatch(pending, entry.event)
+		go func() {
+			p.deliverTargets(entry.event.ctx, entry.event.event, dir, entry.event.targets)
+			o.done <- orderedResult{event: entry.event, dir: dir, key: entry.key}
+		}()
+	}
+	o.waiting = waiting
+}
+
+// queued returns the waiting events that are still current, so they count as
+// waiting instead of pending. A nil dispatch has none.
+func (o *orderedDispatch) queued(pending map[string]*pendingFileEvent) map[*pendingFileEvent]struct{} {
+	if o == nil {
+		return nil
+	}
+	queued := make(map[*pendingFileEvent]struct{}, len(o.waiting))
+	for _, entry := range o.waiting {
+		if current, ok := pending[entry.event.event.Path]; ok && current == entry.event && current.seq == entry.seq {
+			queued[current] = struct{}{}
+		}
+	}
+	return queued
+}
+
+// busy reports whether the key of a waiting event has a dispatch in progress or a
+// different event waiting for its retry. A key is released when the event that
+// waits for its retry was dropped.
+func (o *orderedDispatch) busy(pending map[string]*pendingFileEvent, entry orderedEntry) bool {
+	if _, ok := o.running[entry.key]; ok {
+		return true
+	}
+	retry, ok := o.retrying[entry.key]
+	if !ok || retry == entry.event {
+		return false
+	}
+	if current, ok := pending[retry.event.Path]; !ok || current != retry {
+		delete(o.retrying, entry.key)
+		return false
+	}
+	return true
+}
+
+// finishOrdered completes a finished dispatch and starts the events waiting for
+// its key. A failed event keeps its key until it is retried, so the events
+// behind it stay in order. The caller must hold pendingMu.
+func (p *Plugin) finishOrdered(pending map[string]*pendingFileEvent, timers *eventTimers, result orderedResult) {
+	delete(p.ordered.running, result.key)
+	p.finishDispatch(pending, timers, result.event, result.dir)
+	if current, ok := pending[result.event.event.Path]; ok && current == result.event {
+		p.ordered.retrying[result.key] = result.event
+	}
+	p.startOrdered(pending)
+}
+
+// stopOrdered drops the waiting events and waits for the running dispatches when
+// the event loop stops. The caller must hold pendingMu; it is released while the
+// dispatches finish.
+func (p *Plugin) stopOrdered(pending map[string]*pendingFileEvent, timers *eventTimers) {
+	o := p.ordered
+	if o == nil {
+		return
+	}
+	o.waiting = nil
+	clear(o.retrying)
+	for len(o.running) > 0 {
+		p.pendingMu.Unlock()
+		result := <-o.done
+		p.pendingMu.Lock()
+
+		delete(o.running, result.key)
+		p.finishDispatch(pending, timers, result.event, result.dir)
+	}
+}
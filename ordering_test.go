@@ -0,0 +1,262 @@
+package roadrunner
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/radovskyb/watcher"
+	"go.uber.org/zap"
+)
+
+func TestOrderingKeys(t *testing.T) {
+	pattern := regexp.MustCompile(`^(game\d+)\.`)
+	for _, tc := range []struct {
+		key  string
+		path string
+		want string
+	}{
+		{key: OrderPath, path: "/lmx/results/game123.xml", want: "/lmx/results/game123.xml"},
+		{key: OrderDir, path: "/lmx/results/game123.xml", want: "/lmx/results"},
+		{key: OrderPattern, path: "/lmx/results/game123.xml", want: "game123"},
+		{key: OrderPattern, path: "/lmx/results/game123.scores", want: "game123"},
+		{key: OrderPattern, path: "/lmx/results/players.xml", want: "/lmx/results/players.xml"},
+	} {
+		o := newOrderedDispatch(tc.key, pattern, 1)
+		if got := o.eventKey("/lmx/results", tc.path); got != tc.want {
+			t.Fatalf("%s key of %s: expected %s, got %s", tc.key, tc.path, tc.want, got)
+		}
+	}
+}
+
+func TestOrderedDispatchSerializesEventsSharingAKey(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	running := make(map[string]int)
+	var maxRunning, maxSameKey int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var event map[string]interface{}
+		_ = json.Unmarshal(body, &event)
+		file := event["file"].(string)
+		game := file[:len(file)-len(filepath.Ext(file))]
+
+		mu.Lock()
+		order = append(order, file)
+		running[game]++
+		total := 0
+		for _, n := range running {
+			total += n
+		}
+		maxRunning = max(maxRunning, total)
+		maxSameKey = max(maxSameKey, running[game])
+		mu.Unlock()
+
+		time.Sleep(50 * time.Millisecond)
+
+		mu.Lock()
+		running[game]--
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	cfg := &Config{
+		Output:   "importer",
+		Sinks:    map[string]*SinkConfig{"importer": {Type: OutputHTTP, URL: server.URL}},
+		Ordering: &OrderingConfig{Pattern: `^(game\d+)\.`},
+	}
+	cfg.InitDefaults()
+	keyPattern, err := cfg.Ordering.KeyPattern()
+	if err != nil {
+		t.Fatalf("expected ordering pattern to compile: %v", err)
+	}
+	p := &Plugin{
+		cfg:     cfg,
+		log:     zap.NewNop(),
+		sinks:   map[string]Sink{"importer": newTestHTTPSink(t, cfg.Sinks["importer"])},
+		ordered: newOrderedDispatch(cfg.Ordering.Key, keyPattern, cfg.Ordering.Parallelism),
+	}
+	p.metrics = newStatsExporter(p, nil)
+	pending := make(map[string]*pendingFileEvent)
+	timers := newEventTimers()
+
+	dir := t.TempDir()
+	p.pendingMu.Lock()
+	defer p.pendingMu.Unlock()
+	for _, file := range []string{"game1.xml", "game1.scores", "game2.xml"} {
+		path := filepath.Join(dir, file)
+		if err = os.WriteFile(path, []byte("content"), 0644); err != nil {
+			t.Fatalf("failed to write result file: %v", err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("failed to stat result file: %v", err)
+		}
+		p.dispatchPendingEvent(pending, timers, queueEvent(pending, watcher.Event{Path: path, Op: watcher.Create, FileInfo: info}))
+	}
+	for len(p.ordered.running) > 0 {
+		p.pendingMu.Unlock()
+		result := <-p.ordered.done
+		p.pendingMu.Lock()
+		p.finishOrdered(pending, timers, result)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(order) != 3 || len(pending) != 0 {
+		t.Fatalf("expected every event to be dispatched, got %v with %d pending", order, len(pending))
+	}
+	if maxSameKey != 1 {
+		t.Fatalf("expected events of one game to run one at a time, got %d", maxSameKey)
+	}
+	if maxRunning != 2 {
+		t.Fatalf("expected both games to run in parallel, got %d", maxRunning)
+	}
+	if slices.Index(order, "game1.xml") > slices.Index(order, "game1.scores") {
+		t.Fatalf("expected game1.xml before game1.scores, got %v", order)
+	}
+}
+
+func TestOrderedDispatchKeepsKeyBusyUntilRetry(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	var failed bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var event map[string]interface{}
+		_ = json.Unmarshal(body, &event)
+		file := event["file"].(string)
+
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, file)
+		// The first attempt of game1.xml fails.
+		if file == "game1.xml" && !failed {
+			failed = true
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	cfg := &Config{
+		MaxAttempts:  2,
+		RetryBackoff: "10ms",
+		Output:       "importer",
+		Sinks:        map[string]*SinkConfig{"importer": {Type: OutputHTTP, URL: server.URL}},
+		Ordering:     &OrderingConfig{Pattern: `^(game\d+)\.`},
+	}
+	cfg.InitDefaults()
+	keyPattern, err := cfg.Ordering.KeyPattern()
+	if err != nil {
+		t.Fatalf("expected ordering pattern to compile: %v", err)
+	}
+	p := &Plugin{
+		cfg:     cfg,
+		log:     zap.NewNop(),
+		sinks:   map[string]Sink{"importer": newTestHTTPSink(t, cfg.Sinks["importer"])},
+		ordered: newOrderedDispatch(cfg.Ordering.Key, keyPattern, cfg.Ordering.Parallelism),
+	}
+	p.metrics = newStatsExporter(p, nil)
+	pending := make(map[string]*pendingFileEvent)
+	timers := newEventTimers()
+	defer timers.stop()
+
+	dir := t.TempDir()
+	p.pendingMu.Lock()
+	defer p.pendingMu.Unlock()
+	for _, file := range []string{"game1.xml", "game1.scores"} {
+		path := filepath.Join(dir, file)
+		if err = os.WriteFile(path, []byte("content"), 0644); err != nil {
+			t.Fatalf("failed to write result file: %v", err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("failed to stat result file: %v", err)
+		}
+		p.dispatchPendingEvent(pending, timers, queueEvent(pending, watcher.Event{Path: path, Op: watcher.Create, FileInfo: info}))
+	}
+
+	deadline := time.After(2 * time.Second)
+	for len(pending) > 0 || len(p.ordered.running) > 0 {
+		p.pendingMu.Unlock()
+		select {
+		case result := <-p.ordered.done:
+			p.pendingMu.Lock()
+			p.finishOrdered(pending, timers, result)
+		case <-timers.C:
+			p.pendingMu.Lock()
+			for _, eventRef := range timers.due(time.Now()) {
+				if pendingEvent, ok := pending[eventRef.path]; ok && pendingEvent.seq == eventRef.seq {
+					p.dispatchPendingEvent(pending, timers, pendingEvent)
+				}
+			}
+		case <-deadline:
+			p.pendingMu.Lock()
+			t.Fatalf("timed out with %d events pending", len(pending))
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Equal(order, []string{"game1.xml", "game1.xml", "game1.scores"}) {
+		t.Fatalf("expected game1.scores to wait for the retry of game1.xml, got %v", order)
+	}
+}
+
+func TestOrderedEventsWaitingForTheirKeyCountAsWaiting(t *testing.T) {
+	p := &Plugin{cfg: &Config{}, log: zap.NewNop(), ordered: newOrderedDispatch(OrderDir, nil, 2)}
+	p.metrics = newStatsExporter(p, nil)
+	next := &pendingFileEvent{detected: time.Now(), seq: 1}
+	pending := map[string]*pendingFileEvent{
+		"game1.xml":    {detected: time.Now(), seq: 1},
+		"game1.scores": next,
+	}
+	next.event.Path = "game1.scores"
+	p.ordered.running["/lmx/results"] = struct{}{}
+	p.ordered.waiting = []orderedEntry{{event: next, seq: 1, key: "/lmx/results"}}
+	timers := newEventTimers()
+	defer timers.stop()
+
+	p.updateQueueMetrics(pending, timers)
+
+	if got := *p.metrics.waiting; got != 1 {
+		t.Fatalf("expected the event behind the busy key to wait, got %d", got)
+	}
+	if got := *p.metrics.pending; got != 1 {
+		t.Fatalf("expected one debouncing event, got %d", got)
+	}
+}
+
+func TestConfigRejectsInvalidOrdering(t *testing.T) {
+	for name, ordering := range map[string]*OrderingConfig{
+		"unknown key":         {Key: "game"},
+		"invalid pattern":     {Pattern: `^(game`},
+		"no capture group":    {Pattern: `^game\d+`},
+		"pattern without key": {Key: OrderDir, Pattern: `^(game\d+)\.`},
+		"negative workers":    {Parallelism: -1},
+	} {
+		cfg := &Config{Dir: t.TempDir(), Ordering: ordering}
+		cfg.InitDefaults()
+
+		if err := cfg.Validate(); err == nil {
+			t.Fatalf("expected %s to be rejected", name)
+		}
+	}
+
+	cfg := &Config{Dir: t.TempDir(), Ordering: &OrderingConfig{}, Batch: &BatchConfig{}}
+	cfg.InitDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected ordering with batch to be rejected")
+	}
+}
@@ -0,0 +1,230 @@
+package roadrunner
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/radovskyb/watcher"
+	rrErrors "github.com/roadrunner-server/errors"
+	"go.uber.org/zap"
+)
+
+// spillFileName is the file inside spill_dir that holds spilled events.
+const spillFileName = "events.spill"
+
+// blockedEvent is a file event that waits for room in the pending queue.
+type blockedEvent struct {
+	event   watcher.Event
+	queueID uint64
+}
+
+// eventSpill keeps the file events that found the pending queue full on disk, one
+// queueRecord per line with the write-ahead log record as id, until the queue
+// has room for them again. Spilled events are not kept over a restart; the
+// write-ahead log of queue_dir covers that. It is owned by the event loop. A nil
+// spill holds nothing.
+type eventSpill struct {
+	path   string
+	writer *os.File
+	reader *os.File
+	lines  *bufio.Reader
+	count  int
+}
+
+// openEventSpill creates an empty spill file in dir.
+func openEventSpill(dir string) (*eventSpill, error) {
+	const op = rrErrors.Op("file_watch_spill_open")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, rrErrors.E(op, err)
+	}
+
+	path := filepath.Join(dir, spillFileName)
+	writer, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, rrErrors.E(op, err)
+	}
+	reader, err := os.Open(path)
+	if err != nil {
+		_ = writer.Close()
+		return nil, rrErrors.E(op, err)
+	}
+	return &eventSpill{path: path, writer: writer, reader: reader, lines: bufio.NewReader(reader)}, nil
+}
+
+// len returns the number of spilled events.
+func (s *eventSpill) len() int {
+	if s == nil {
+		return 0
+	}
+	return s.count
+}
+
+// add appends an event with its write-ahead log record id.
+func (s *eventSpill) add(event watcher.Event, queueID uint64) error {
+	if s == nil {
+		return rrErrors.Str("spill is not open")
+	}
+	line, err := json.Marshal(newQueueRecord(queueID, event))
+	if err != nil {
+		return err
+	}
+	if _, err = s.writer.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	s.count++
+	return nil
+}
+
+// next removes the oldest spilled event and returns it. The file is emptied once
+// every event was read back.
+func (s *eventSpill) next() (queueRecord, error) {
+	var record queueRecord
+	line, err := s.lines.ReadBytes('\n')
+	if err != nil {
+		return record, err
+	}
+	s.count--
+	if s.count == 0 {
+		if err = s.reset(); err != nil {
+			return record, err
+		}
+	}
+	return record, json.Unmarshal(line, &record)
+}
+
+// reset empties the file and forgets the events in it.
+func (s *eventSpill) reset() error {
+	s.count = 0
+	if err := s.writer.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := s.reader.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	s.lines.Reset(s.reader)
+	return nil
+}
+
+// close closes and removes the file.
+func (s *eventSpill) close() error {
+	if s == nil {
+		return nil
+	}
+	err := s.writer.Close()
+	if readErr := s.reader.Close(); err == nil {
+		err = readErr
+	}
+	if removeErr := os.Remove(s.path); err == nil && !os.IsNotExist(removeErr) {
+		err = removeErr
+	}
+	return err
+}
+
+// closeSpill closes the spill file when the event loop stops. Spilled events are
+// lost unless the write-ahead log recovers them. The caller must hold pendingMu.
+func (p *Plugin) closeSpill() {
+	if count := p.spill.len(); count > 0 {
+		p.log.Warn("spilled events were not dispatched before the stop", zap.Int("events", count))
+	}
+	if err := p.spill.close(); err != nil {
+		p.log.Warn("failed to close the spill file", zap.Error(err))
+	}
+	p.spill = nil
+	p.metrics.SetSpilled(0)
+}
+
+// pendingFull reports whether a file event needs room that the pending queue does
+// not have. Events for a path that is already pending, and renames of one, only
+// replace it. While events are spilled, new files are spilled after them.
+func (p *Plugin) pendingFull(pending map[string]*pendingFileEvent, event watcher.Event) bool {
+	if _, ok := pending[event.Path]; ok || p.cfg.PendingCapacity <= 0 {
+		return false
+	}
+	if _, ok := pending[event.OldPath]; ok && isRenameEvent(event) {
+		return false
+	}
+	return len(pending) >= p.cfg.PendingCapacity || p.spill.len() > 0
+}
+
+// overflowEvent handles a file event that found the pending queue full according
+// to pending_overflow: drop_oldest drops the event detected first and queues the
+// new one, spill writes the new one to disk, and block returns it to wait for
+// room. The caller must hold pendingMu.
+func (p *Plugin) overflowEvent(pending map[string]*pendingFileEvent, timers *eventTimers, held []string, event watcher.Event, queueID uint64, debounce time.Duration) ([]string, *blockedEvent) {
+	p.metrics.CountOverflow(p.cfg.PendingOverflow)
+	switch p.cfg.PendingOverflow {
+	case OverflowDropOldest:
+		p.dropOldestPending(pending)
+		return p.queueFileEvent(pending, timers, held, event, queueID, debounce), nil
+	case OverflowSpill:
+		if err := p.spill.add(event, queueID); err != nil {
+			// Keeping the event above the capacity beats losing it.
+			p.log.Error("failed to spill event, queued above the capacity", zap.String("path", event.Path), zap.Error(err))
+			return p.queueFileEvent(pending, timers, held, event, queueID, debounce), nil
+		}
+		p.metrics.SetSpilled(p.spill.len())
+		p.log.Debug("pending queue is full, event spilled", zap.String("path", event.Path), zap.Int("spilled", p.spill.len()))
+		return held, nil
+	}
+
+	p.metrics.SetOverflowBlocked(true)
+	p.log.Warn("pending queue is full, waiting for room", zap.String("path", event.Path), zap.Int("capacity", p.cfg.PendingCapacity))
+	return held, &blockedEvent{event: event, queueID: queueID}
+}
+
+// dropOldestPending drops the pending event detected first. The caller must hold
+// pendingMu.
+func (p *Plugin) dropOldestPending(pending map[string]*pendingFileEvent) {
+	var oldest *pendingFileEvent
+	for _, pendingEvent := range pending {
+		if oldest == nil || pendingEvent.detected.Before(oldest.detected) {
+			oldest = pendingEvent
+		}
+	}
+	if oldest == nil {
+		return
+	}
+
+	delete(pending, oldest.event.Path)
+	p.log.Warn("pending queue is full, event dropped", zap.String("path", oldest.event.Path), zap.String("overflow", p.cfg.PendingOverflow))
+	p.dropEvent(oldest, rrErrors.Str("event dropped because the pending queue was full"))
+}
+
+// refillPending queues the blocked event and then spilled events, oldest first,
+// while the pending queue has room. It returns the event that is still blocked.
+// The caller must hold pendingMu.
+func (p *Plugin) refillPending(pending map[string]*pendingFileEvent, timers *eventTimers, held []string, blocked *blockedEvent, debounce time.Duration) ([]string, *blockedEvent) {
+	if blocked != nil {
+		if p.pendingFull(pending, blocked.event) {
+			return held, blocked
+		}
+		held = p.queueFileEvent(pending, timers, held, blocked.event, blocked.queueID, debounce)
+		p.metrics.SetOverflowBlocked(false)
+		blocked = nil
+	}
+
+	for p.spill.len() > 0 && len(pending) < p.cfg.PendingCapacity {
+		record, err := p.spill.next()
+		if err != nil {
+			// The write-ahead log, if any, still has the events.
+			p.log.Error("failed to read spilled events, dropping them", zap.Int("events", p.spill.len()), zap.Error(err))
+			if err = p.spill.reset(); err != nil {
+				p.log.Error("failed to empty the spill file", zap.Error(err))
+			}
+			break
+		}
+		event, err := recordEvent(record)
+		if err != nil {
+			p.log.Debug("spilled file no longer exists", zap.String("path", record.Path), zap.Error(err))
+			p.queue.done(record.Path, record.ID, p.log)
+			continue
+		}
+		held = p.queueFileEvent(pending, timers, held, event, record.ID, debounce)
+	}
+	p.metrics.SetSpilled(p.spill.len())
+	return held, blocked
+}
@@ -0,0 +1,194 @@
+package roadrunner
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/radovskyb/watcher"
+	"go.uber.org/zap"
+)
+
+func newOverflowPlugin(t *testing.T, capacity int, overflow string) *Plugin {
+	t.Helper()
+	cfg := &Config{Dir: t.TempDir(), PendingCapacity: capacity, PendingOverflow: overflow, SpillDir: t.TempDir()}
+	cfg.InitDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected overflow config to be valid: %v", err)
+	}
+	p := &Plugin{cfg: cfg, log: zap.NewNop()}
+	p.metrics = newStatsExporter(p, nil)
+	return p
+}
+
+func TestPendingOverflowDropsOldestEvent(t *testing.T) {
+	p := newOverflowPlugin(t, 2, OverflowDropOldest)
+	pending := make(map[string]*pendingFileEvent)
+	timers := newEventTimers()
+	defer timers.stop()
+
+	for _, path := range []string{"first.game", "second.game", "third.game"} {
+		event := watcher.Event{Path: path, Op: watcher.Create}
+		if p.pendingFull(pending, event) {
+			p.overflowEvent(pending, timers, nil, event, 0, time.Hour)
+		} else {
+			p.queueFileEvent(pending, timers, nil, event, 0, time.Hour)
+		}
+	}
+	// A change of a pending file needs no room.
+	if p.pendingFull(pending, watcher.Event{Path: "third.game", Op: watcher.Write}) {
+		t.Fatal("expected a pending path to be accepted at capacity")
+	}
+
+	if _, ok := pending["first.game"]; ok || len(pending) != 2 {
+		t.Fatalf("expected first.game to be dropped, got %d pending", len(pending))
+	}
+	if got := *p.metrics.eventsDropped; got != 1 {
+		t.Fatalf("expected one dropped event, got %d", got)
+	}
+}
+
+func TestPendingOverflowSpillsEventsToDisk(t *testing.T) {
+	p := newOverflowPlugin(t, 1, OverflowSpill)
+	var err error
+	if p.spill, err = openEventSpill(p.cfg.SpillDir); err != nil {
+		t.Fatalf("failed to open spill: %v", err)
+	}
+	defer p.closeSpill()
+
+	dir := t.TempDir()
+	var paths []string
+	for _, name := range []string{"1.game", "2.game", "3.game"} {
+		path := filepath.Join(dir, name)
+		if err = os.WriteFile(path, []byte("content"), 0644); err != nil {
+			t.Fatalf("failed to write result file: %v", err)
+		}
+		paths = append(paths, path)
+	}
+	pending := make(map[string]*pendingFileEvent)
+	timers := newEventTimers()
+	defer timers.stop()
+
+	p.queueFileEvent(pending, timers, nil, watcher.Event{Path: paths[0], Op: watcher.Create}, 0, time.Hour)
+	for _, path := range paths[1:] {
+		event := watcher.Event{Path: path, Op: watcher.Create}
+		if !p.pendingFull(pending, event) {
+			t.Fatalf("expected %s to find the queue full", path)
+		}
+		p.overflowEvent(pending, timers, nil, event, 0, time.Hour)
+	}
+	if p.spill.len() != 2 || *p.metrics.spilled != 2 {
+		t.Fatalf("expected two spilled events, got %d", p.spill.len())
+	}
+
+	// Nothing is read back while the queue is full.
+	p.refillPending(pending, timers, nil, nil, time.Hour)
+	if p.spill.len() != 2 {
+		t.Fatalf("expected the spilled events to wait for room, got %d spilled", p.spill.len())
+	}
+
+	delete(pending, paths[0])
+	p.refillPending(pending, timers, nil, nil, time.Hour)
+	if _, ok := pending[paths[1]]; !ok || p.spill.len() != 1 {
+		t.Fatalf("expected the oldest spilled event to be queued, got %d pending and %d spilled", len(pending), p.spill.len())
+	}
+
+	delete(pending, paths[1])
+	p.refillPending(pending, timers, nil, nil, time.Hour)
+	if _, ok := pending[paths[2]]; !ok || p.spill.len() != 0 {
+		t.Fatalf("expected the last spilled event to be queued, got %d spilled", p.spill.len())
+	}
+	if info, err := os.Stat(filepath.Join(p.cfg.SpillDir, spillFileName)); err != nil || info.Size() != 0 {
+		t.Fatalf("expected the empty spill file to be truncated: %v", err)
+	}
+}
+
+func TestSpilledRemoveIsQueuedFromItsRecord(t *testing.T) {
+	p := newOverflowPlugin(t, 1, OverflowSpill)
+	var err error
+	if p.spill, err = openEventSpill(p.cfg.SpillDir); err != nil {
+		t.Fatalf("failed to open spill: %v", err)
+	}
+	defer p.closeSpill()
+
+	path := filepath.Join(t.TempDir(), "1.game")
+	if err = os.WriteFile(path, []byte("content"), 0644); err != nil {
+		t.Fatalf("failed to write result file: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat result file: %v", err)
+	}
+	if err = p.spill.add(watcher.Event{Path: path, Op: watcher.Remove, FileInfo: info}, 0); err != nil {
+		t.Fatalf("failed to spill the remove: %v", err)
+	}
+	if err = os.Remove(path); err != nil {
+		t.Fatalf("failed to remove result file: %v", err)
+	}
+
+	pending := make(map[string]*pendingFileEvent)
+	timers := newEventTimers()
+	defer timers.stop()
+	p.refillPending(pending, timers, nil, nil, time.Hour)
+
+	queued, ok := pending[path]
+	if !ok || queued.event.Op != watcher.Remove {
+		t.Fatalf("expected the spilled remove to be queued, got %d pending", len(pending))
+	}
+	if !queued.event.ModTime().Equal(info.ModTime()) || queued.event.Size() != info.Size() {
+		t.Fatalf("expected the remove to keep the stored file info, got %v", queued.event.FileInfo)
+	}
+}
+
+func TestPendingOverflowBlocksTheWatcher(t *testing.T) {
+	p := newOverflowPlugin(t, 1, OverflowBlock)
+	w := watcher.New()
+	stopCh := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		p.watchEvents(w, time.Hour, stopCh, nil, nil)
+		close(stopped)
+	}()
+
+	send := func(path string) bool {
+		select {
+		case w.Event <- watcher.Event{Path: path, Op: watcher.Create}:
+			return true
+		case <-time.After(100 * time.Millisecond):
+			return false
+		}
+	}
+	if !send("first.game") || !send("second.game") {
+		t.Fatal("expected the loop to read the event that found the queue full")
+	}
+	if send("third.game") {
+		t.Fatal("expected the loop to stop reading while an event waits for room")
+	}
+	if got := atomic.LoadUint64(p.metrics.overflowBlocked); got != 1 {
+		t.Fatalf("expected the blocked gauge to be set, got %d", got)
+	}
+
+	close(stopCh)
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("expected the blocked loop to stop")
+	}
+}
+
+func TestConfigRejectsInvalidPendingOverflow(t *testing.T) {
+	for name, cfg := range map[string]*Config{
+		"negative capacity":     {PendingCapacity: -1},
+		"unknown policy":        {PendingOverflow: "drop_newest"},
+		"spill without its dir": {PendingOverflow: OverflowSpill},
+	} {
+		cfg.Dir = t.TempDir()
+		cfg.InitDefaults()
+
+		if err := cfg.Validate(); err == nil {
+			t.Fatalf("expected %s to be rejected", name)
+		}
+	}
+}
@@ -4,11 +4,17 @@ import (
 	"context"
 	"encoding/json"
 	"os"
+	"path/filepath"
 	"regexp"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/radovskyb/watcher"
+	"github.com/roadrunner-server/endure/v2/dep"
 	"github.com/roadrunner-server/errors"
+	"github.com/roadrunner-server/events"
 	"github.com/roadrunner-server/pool/pool/static_pool"
 	"github.com/roadrunner-server/pool/state/process"
 	"go.uber.org/zap"
@@ -29,6 +35,65 @@ type Plugin struct {
 	server      Server
 	log         *zap.Logger
 	metrics     *statsExporter
+	// jobs is the collected jobs plugin that jobs sinks push events to, guarded
+	// by mu. Nil when RoadRunner runs without it.
+	jobs Jobs
+	// sinks deliver events by sink name; watches select theirs, Output is the default.
+	sinks map[string]Sink
+	// withoutPool is set when no sink executes events on the worker pool, so no
+	// pool is created.
+	withoutPool bool
+	// events is RoadRunner's events bus the plugin publishes BusEvents to.
+	events events.EventBus
+	// watchState holds runtime watch changes persisted to cfg.StateFile.
+	watchState *watchState
+	// missingDirs are configured directories that do not exist (yet) and are
+	// checked again every cfg.DirCheckInterval.
+	missingDirs []string
+	// schedules holds the parsed active hours of the watches entries by directory.
+	schedules map[string]*activeSchedule
+	// batch collects ready events in batch mode, guarded by pendingMu. Nil
+	// dispatches every event on its own.
+	batch *eventBatch
+	// rateLimit and watchRateLimits hold the global and per-watch rate limits by
+	// directory, guarded by pendingMu. Nil buckets do not limit.
+	rateLimit       *tokenBucket
+	watchRateLimits map[string]*tokenBucket
+	// queue is the write-ahead log of unacknowledged events, opened by Serve and
+	// closed by the event loop. Nil without queue_dir. recovered holds the events it
+	// kept from the last run until the event loop queues them.
+	queue     *eventQueue
+	recovered []queueRecord
+	// spill holds the file events that found the pending queue full with
+	// pending_overflow spill, opened by Serve and closed by the event loop.
+	spill *eventSpill
+	// breakers holds the circuit breaker of every sink by name. Nil without
+	// circuit_breaker.
+	breakers map[string]*circuitBreaker
+	// ordered runs dispatches in parallel by ordering key, guarded by pendingMu.
+	// Nil dispatches one event at a time.
+	ordered *orderedDispatch
+	// errorRate counts dispatch outcomes for the error rate health check.
+	errorRate *errorRate
+	// watcherErr is set when the file watcher stopped with an error.
+	watcherErr atomic.Pointer[error]
+
+	// paused holds ready events in the pending queue instead of dispatching them.
+	paused atomic.Bool
+	// held is the number of events currently held while paused.
+	held atomic.Int64
+	// resumeCh wakes the event loop to dispatch held events after Resume.
+	resumeCh chan struct{}
+	// replayCh feeds files found by rescan jobs into the event loop.
+	replayCh chan replayEvent
+	rescans  *rescanJobs
+
+	// pendingMu guards pending, the debounce queue owned by the event loop.
+	pendingMu sync.Mutex
+	pending   map[string]*pendingFileEvent
+	// deadLetters are files whose last dispatch attempt failed, guarded by pendingMu.
+	deadLetters map[string]time.Time
+	inFlight    inFlightDispatches
 
 	// signal channel to stop the pollers
 	stopCh   chan struct{}
@@ -58,7 +123,42 @@ func (p *Plugin) Init(cfg Configurer, log Logger, server Server) error {
 	p.log = new(zap.Logger)
 	p.log = log.NamedLogger(PluginName)
 
-	p.metrics = newStatsExporter(p)
+	p.metrics = newStatsExporter(p, p.cfg)
+	p.events, _ = events.NewEventBus()
+	p.rescans = newRescanJobs()
+	p.sinks = make(map[string]Sink)
+	p.withoutPool = true
+	for _, name := range p.cfg.SinkNames() {
+		sinkCfg, _ := p.cfg.Sink(name)
+		if p.sinks[name], err = p.newSink(sinkCfg); err != nil {
+			return errors.E(op, err)
+		}
+		if sinkCfg.Type == OutputPool {
+			p.withoutPool = false
+		}
+	}
+
+	p.schedules = make(map[string]*activeSchedule, len(p.cfg.Watches))
+	for _, watch := range p.cfg.Watches {
+		// Already validated, so parsing cannot fail here.
+		schedule, _ := watch.Schedule()
+		p.schedules[filepath.Clean(watch.Dir)] = schedule
+	}
+	if p.cfg.Batch != nil {
+		batchWait, _ := p.cfg.Batch.WaitDuration()
+		p.batch = newEventBatch(p.cfg.Batch.Size, batchWait)
+	}
+	p.rateLimit, p.watchRateLimits = newRateLimits(p.cfg)
+	p.breakers = newCircuitBreakers(p.cfg)
+	for name := range p.breakers {
+		p.metrics.SetCircuitState(name, circuitClosed)
+	}
+	if p.cfg.Ordering != nil {
+		keyPattern, _ := p.cfg.Ordering.KeyPattern()
+		p.ordered = newOrderedDispatch(p.cfg.Ordering.Key, keyPattern, p.cfg.Ordering.Parallelism)
+	}
+	errorRateWindow, _ := p.cfg.ErrorRateWindowDuration()
+	p.errorRate = newErrorRate(errorRateWindow)
 
 	return nil
 }
@@ -67,41 +167,103 @@ func (p *Plugin) Serve() chan error {
 	errCh := make(chan error, 1)
 	const op = errors.Op("file_watch_plugin_serve")
 
+	// Apply watch directories added or removed at runtime and persisted via RPC
+	state, stateErr := loadWatchState(p.cfg.StateFile)
+	if stateErr != nil {
+		errCh <- errors.E(op, stateErr)
+		return errCh
+	}
+	// Jobs sinks push in-process, so the jobs plugin must have been collected.
+	for name, sink := range p.sinks {
+		if _, ok := sink.(*jobsSink); ok && p.jobs == nil {
+			errCh <- errors.E(op, errors.Errorf("sink %q needs the jobs plugin", name))
+			return errCh
+		}
+	}
+	p.watchState = state
+	p.cfg.Dirs = state.apply(p.cfg.WatchDirs())
+	p.cfg.Dir = ""
+
 	// Validate directory config
+	dirCheckInterval, err := p.cfg.DirCheckIntervalDuration()
+	if err != nil {
+		errCh <- errors.E(op, err)
+		return errCh
+	}
 	validDirs, dirErr := p.validWatchDirs()
 	if dirErr != nil {
-		errCh <- errors.E(op, dirErr)
-		return errCh
+		// Without the periodic directory check nothing would ever be watched.
+		if dirCheckInterval == 0 {
+			errCh <- errors.E(op, dirErr)
+			return errCh
+		}
+		p.log.Warn("waiting for a configured watch directory to appear", zap.Error(dirErr))
 	}
+	p.missingDirs = slices.DeleteFunc(p.cfg.WatchDirs(), func(dir string) bool {
+		return slices.Contains(validDirs, dir)
+	})
 	p.cfg.Dirs = validDirs
 	p.cfg.Dir = ""
+	for _, dir := range validDirs {
+		p.metrics.SetWatchDir(dir, true)
+	}
+	for _, dir := range p.missingDirs {
+		p.metrics.SetWatchDir(dir, false)
+	}
 
 	// Validate Regexp
 	if p.cfg.Regexp != "" {
-		_, err := regexp.Compile(p.cfg.Regexp)
+		_, err = regexp.Compile(p.cfg.Regexp)
 		if err != nil {
 			errCh <- errors.E(op, err)
 			return errCh
 		}
 	}
 
+	// Events that were not acknowledged before the last stop are dispatched again.
+	if p.cfg.QueueDir != "" {
+		p.queue, p.recovered, err = openEventQueue(p.cfg.QueueDir)
+		if err != nil {
+			errCh <- errors.E(op, err)
+			return errCh
+		}
+	}
+	if p.cfg.PendingOverflow == OverflowSpill {
+		p.spill, err = openEventSpill(p.cfg.SpillDir)
+		if err != nil {
+			_ = p.queue.close()
+			errCh <- errors.E(op, err)
+			return errCh
+		}
+	}
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
 	p.stopCh = make(chan struct{})
 	p.stopOnce = sync.Once{}
+	p.resumeCh = make(chan struct{}, 1)
+	p.replayCh = make(chan replayEvent)
+	p.watcherErr.Store(nil)
 
-	var err error
-	p.workersPool, err = p.server.NewPool(context.Background(), p.cfg.Pool, map[string]string{RrMode: RrModeFileWatch}, nil)
-	if err != nil {
-		errCh <- errors.E(op, err)
-		return errCh
+	if !p.withoutPool {
+		p.workersPool, err = p.server.NewPool(context.Background(), p.cfg.Pool, map[string]string{RrMode: RrModeFileWatch}, nil)
+		if err != nil {
+			_ = p.queue.close()
+			_ = p.spill.close()
+			errCh <- errors.E(op, err)
+			return errCh
+		}
 	}
 
 	// start listening
 	if err = p.listener(); err != nil {
-		p.workersPool.Destroy(context.Background())
-		p.workersPool = nil
+		_ = p.queue.close()
+		_ = p.spill.close()
+		if p.workersPool != nil {
+			p.workersPool.Destroy(context.Background())
+			p.workersPool = nil
+		}
 		errCh <- errors.E(op, err)
 		return errCh
 	}
@@ -145,12 +307,36 @@ func (p *Plugin) Name() string {
 	return PluginName
 }
 
+// Collects declares the plugins collected from the container: the jobs plugin
+// that jobs sinks push events to, when RoadRunner runs with it.
+func (p *Plugin) Collects() []*dep.In {
+	return []*dep.In{
+		dep.Fits(p.collectJobs, (*Jobs)(nil)),
+	}
+}
+
+// collectJobs receives the jobs plugin collected from the container.
+func (p *Plugin) collectJobs(pp any) {
+	jobs, ok := pp.(Jobs)
+	if !ok {
+		return
+	}
+	p.mu.Lock()
+	p.jobs = jobs
+	p.mu.Unlock()
+}
+
 func (p *Plugin) Reset() error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
 	const op = errors.Op("file_watch_plugin_reset")
 	p.log.Info("reset signal was received")
+	if p.withoutPool {
+		// Events are processed outside of RoadRunner's workers or by the jobs
+		// plugin's workers, which it resets itself.
+		return nil
+	}
 	if p.workersPool == nil {
 		return errors.E(op, errors.Str("worker pool is not initialized"))
 	}
@@ -168,10 +354,29 @@ func (p *Plugin) Stop(ctx context.Context) error {
 	defer p.mu.Unlock()
 
 	if p.watcher != nil {
-		p.watcher.Close()
+		// The event loop stops reading file events while an event waits for room in
+		// the pending queue, and the watcher only sees the close signal between
+		// events. Events it still sends are discarded until it has closed.
+		w := p.watcher
+		go func() {
+			for {
+				select {
+				case <-w.Event:
+				case <-w.Closed:
+					return
+				}
+			}
+		}()
+		w.Close()
 		p.watcher = nil
 	}
 
+	for name, sink := range p.sinks {
+		if err := sink.Close(); err != nil {
+			p.log.Warn("failed to close sink", zap.String("sink", name), zap.Error(err))
+		}
+	}
+
 	if p.stopCh != nil {
 		stopCh := p.stopCh
 		p.stopOnce.Do(func() {
@@ -183,6 +388,35 @@ func (p *Plugin) Stop(ctx context.Context) error {
 	return nil
 }
 
+// pause stops dispatching events. The watcher keeps running and ready events are
+// held in the pending queue until resume is called.
+func (p *Plugin) pause() {
+	if !p.paused.Swap(true) {
+		p.metrics.SetPaused(true)
+		p.log.Info("event dispatch paused")
+	}
+}
+
+// resume dispatches the held events and continues normal dispatch.
+func (p *Plugin) resume() {
+	if !p.paused.Swap(false) {
+		return
+	}
+	p.metrics.SetPaused(false)
+	p.log.Info("event dispatch resumed", zap.Int64("held", p.held.Load()))
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.resumeCh == nil {
+		return
+	}
+	select {
+	case p.resumeCh <- struct{}{}:
+	default:
+		// The event loop has not picked up the previous signal yet.
+	}
+}
+
 func (p *Plugin) Workers() []*process.State {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
@@ -53,3 +53,29 @@ func TestValidWatchDirsFailsWhenNoConfiguredDirectoryIsUsable(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
+
+func TestResumeSignalsEventLoop(t *testing.T) {
+	p := &Plugin{log: zap.NewNop(), resumeCh: make(chan struct{}, 1)}
+	p.metrics = newStatsExporter(p, nil)
+
+	p.resume()
+	select {
+	case <-p.resumeCh:
+		t.Fatal("expected resume without pause to be a no-op")
+	default:
+	}
+
+	p.pause()
+	if !p.paused.Load() {
+		t.Fatal("expected plugin to be paused")
+	}
+	p.resume()
+	if p.paused.Load() {
+		t.Fatal("expected plugin to be resumed")
+	}
+	select {
+	case <-p.resumeCh:
+	default:
+		t.Fatal("expected resume to signal the event loop")
+	}
+}
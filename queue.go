@@ -0,0 +1,324 @@
+package roadrunner
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/radovskyb/watcher"
+	rrErrors "github.com/roadrunner-server/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	// queueFileName is the write-ahead log inside queue_dir.
+	queueFileName = "events.wal"
+	// queueCompactAfter is how many acknowledged records the log collects before it
+	// is rewritten with the events that are still live.
+	queueCompactAfter = 1024
+)
+
+// queueRecord is a line of the write-ahead log. A detected event is written with
+// its op; an acknowledged one with done set. Records of a path with an id up to
+// the one of a done record are acknowledged.
+type queueRecord struct {
+	ID      uint64 `json:"id"`
+	Path    string `json:"path"`
+	Op      string `json:"op,omitempty"`
+	OldPath string `json:"oldPath,omitempty"`
+	// Size, Mode and ModTime are the file info of the event, so events of files
+	// that are gone, like removes, can be replayed.
+	Size    int64       `json:"size,omitempty"`
+	Mode    os.FileMode `json:"mode,omitempty"`
+	ModTime time.Time   `json:"modTime,omitzero"`
+	Done    bool        `json:"done,omitempty"`
+}
+
+// newQueueRecord returns the record of a detected event.
+func newQueueRecord(id uint64, event watcher.Event) queueRecord {
+	record := queueRecord{ID: id, Path: event.Path, Op: opName(event.Op)}
+	if isRenameEvent(event) {
+		record.OldPath = event.OldPath
+	}
+	if event.FileInfo != nil {
+		record.Size = event.Size()
+		record.Mode = event.Mode()
+		record.ModTime = event.ModTime()
+	}
+	return record
+}
+
+// recordEvent returns the event of a record. A remove is replayed with the stored
+// file info, and so is a rename, whose info belongs to the old path. Other events
+// need the file to still exist; os.Stat fails for files that are gone.
+func recordEvent(record queueRecord) (watcher.Event, error) {
+	event := watcher.Event{Op: parseOpName(record.Op), Path: record.Path, OldPath: record.OldPath}
+	if event.Op == watcher.Remove {
+		event.FileInfo = recordedFileInfo{record}
+		return event, nil
+	}
+
+	info, err := os.Stat(record.Path)
+	if err != nil {
+		return event, err
+	}
+	event.FileInfo = info
+	if isRenameEvent(event) && !record.ModTime.IsZero() {
+		event.FileInfo = recordedFileInfo{record}
+	}
+	return event, nil
+}
+
+// recordedFileInfo is the file info stored in a queueRecord.
+type recordedFileInfo struct {
+	record queueRecord
+}
+
+func (i recordedFileInfo) Name() string       { return filepath.Base(i.record.Path) }
+func (i recordedFileInfo) Size() int64        { return i.record.Size }
+func (i recordedFileInfo) Mode() os.FileMode  { return i.record.Mode }
+func (i recordedFileInfo) ModTime() time.Time { return i.record.ModTime }
+func (i recordedFileInfo) IsDir() bool        { return i.record.Mode.IsDir() }
+func (i recordedFileInfo) Sys() any           { return nil }
+
+// eventQueue is the write-ahead log of detected events that were not acknowledged
+// yet. Every record is synced to disk before the event is queued, so the events
+// survive a crash and are dispatched again on the next start. A nil queue does
+// nothing.
+type eventQueue struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	// live holds the latest unacknowledged record of every path.
+	live   map[string]queueRecord
+	nextID uint64
+	// acked counts the records acknowledged since the log was last compacted.
+	acked int
+}
+
+// openEventQueue opens the write-ahead log in dir and returns the events that were
+// not acknowledged before the last stop, oldest first. The log is compacted to
+// these events.
+func openEventQueue(dir string) (*eventQueue, []queueRecord, error) {
+	const op = rrErrors.Op("file_watch_queue_open")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, nil, rrErrors.E(op, err)
+	}
+
+	q := &eventQueue{path: filepath.Join(dir, queueFileName), live: make(map[string]queueRecord), nextID: 1}
+	if err := q.load(); err != nil {
+		return nil, nil, rrErrors.E(op, err)
+	}
+	if err := q.compact(); err != nil {
+		return nil, nil, rrErrors.E(op, err)
+	}
+
+	return q, q.records(), nil
+}
+
+// records returns the live records, oldest first.
+func (q *eventQueue) records() []queueRecord {
+	records := slices.Collect(maps.Values(q.live))
+	slices.SortFunc(records, func(a, b queueRecord) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return records
+}
+
+// load replays the log into live. A torn last line of a crash is skipped.
+func (q *eventQueue) load() error {
+	file, err := os.Open(q.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var record queueRecord
+		if err = json.Unmarshal(scanner.Bytes(), &record); err != nil || record.Path == "" {
+			continue
+		}
+		q.nextID = max(q.nextID, record.ID+1)
+		q.apply(record)
+	}
+	return scanner.Err()
+}
+
+// apply folds a record into live.
+func (q *eventQueue) apply(record queueRecord) {
+	current, ok := q.live[record.Path]
+	if record.Done {
+		if ok && current.ID <= record.ID {
+			delete(q.live, record.Path)
+		}
+		return
+	}
+	if !ok || current.ID < record.ID {
+		q.live[record.Path] = record
+	}
+}
+
+// add writes a detected event and returns its record id, or 0 when the queue is
+// nil or the record could not be written.
+func (q *eventQueue) add(event watcher.Event, log *zap.Logger) uint64 {
+	if q == nil {
+		return 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	record := newQueueRecord(q.nextID, event)
+	q.nextID++
+	if err := q.write(record); err != nil {
+		log.Error("failed to write event to the queue", zap.String("path", event.Path), zap.Error(err))
+		return 0
+	}
+	q.apply(record)
+	return record.ID
+}
+
+// done acknowledges the event of path with record id and every earlier one. The
+// log is compacted once enough records were acknowledged.
+func (q *eventQueue) done(path string, id uint64, log *zap.Logger) {
+	if q == nil || id == 0 {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	record := queueRecord{ID: id, Path: path, Done: true}
+	if err := q.write(record); err != nil {
+		log.Error("failed to acknowledge event in the queue", zap.String("path", path), zap.Error(err))
+		return
+	}
+	q.apply(record)
+
+	q.acked++
+	if q.acked >= queueCompactAfter && q.acked > len(q.live) {
+		if err := q.compact(); err != nil {
+			log.Error("failed to compact the queue", zap.Error(err))
+		}
+	}
+}
+
+// write appends a record and syncs it to disk. The caller must hold mu.
+func (q *eventQueue) write(record queueRecord) error {
+	if q.file == nil {
+		return rrErrors.Str("queue is closed")
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err = q.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return q.file.Sync()
+}
+
+// compact replaces the log with the live records and reopens it for appending.
+// The caller must hold mu or own the queue exclusively.
+func (q *eventQueue) compact() error {
+	var buf strings.Builder
+	for _, record := range q.records() {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	tmp := q.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err = file.WriteString(buf.String()); err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if q.file != nil {
+		_ = q.file.Close()
+		q.file = nil
+	}
+	if err = os.Rename(tmp, q.path); err != nil {
+		return err
+	}
+
+	q.file, err = os.OpenFile(q.path, os.O_APPEND|os.O_WRONLY, 0o644)
+	q.acked = 0
+	return err
+}
+
+// close closes the log. Unacknowledged events stay in it for the next start.
+func (q *eventQueue) close() error {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.file == nil {
+		return nil
+	}
+	err := q.file.Close()
+	q.file = nil
+	return err
+}
+
+// closeQueue closes the write-ahead log when the event loop stops. The caller must
+// hold pendingMu.
+func (p *Plugin) closeQueue() {
+	if err := p.queue.close(); err != nil {
+		p.log.Warn("failed to close the queue", zap.Error(err))
+	}
+}
+
+// recoverEvents queues the events the write-ahead log kept from the last run.
+// Events other than removes whose file no longer exists are acknowledged right
+// away. The caller must hold pendingMu.
+func (p *Plugin) recoverEvents(pending map[string]*pendingFileEvent, timers *eventTimers, records []queueRecord) {
+	for _, record := range records {
+		event, err := recordEvent(record)
+		if err != nil {
+			p.log.Debug("queued file no longer exists", zap.String("path", record.Path), zap.Error(err))
+			p.queue.done(record.Path, record.ID, p.log)
+			continue
+		}
+
+		pendingEvent := queueEvent(pending, event)
+		pendingEvent.queueID = record.ID
+		pendingEvent.schedule(timers, 0)
+	}
+	if len(records) > 0 {
+		p.log.Info("recovered queued events", zap.Int("events", len(records)))
+	}
+}
+
+// parseOpName returns the watcher operation of a name returned by opName.
+func parseOpName(name string) watcher.Op {
+	for _, op := range []watcher.Op{watcher.Create, watcher.Write, watcher.Remove, watcher.Rename, watcher.Chmod, watcher.Move, opReplay} {
+		if opName(op) == name {
+			return op
+		}
+	}
+	return watcher.Write
+}
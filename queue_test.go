@@ -0,0 +1,197 @@
+package roadrunner
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/radovskyb/watcher"
+	"go.uber.org/zap"
+)
+
+func TestEventQueueKeepsUnacknowledgedEvents(t *testing.T) {
+	dir := t.TempDir()
+	log := zap.NewNop()
+
+	q, records, err := openEventQueue(dir)
+	if err != nil {
+		t.Fatalf("failed to open queue: %v", err)
+	}
+	if len(records) != 0 {
+		t.Fatalf("expected an empty new queue, got %v", records)
+	}
+	first := q.add(watcher.Event{Path: "/lmx/results/1.game", Op: watcher.Create}, log)
+	second := q.add(watcher.Event{Path: "/lmx/results/2.game", Op: watcher.Write}, log)
+	q.add(watcher.Event{Path: "/lmx/results/3.game", Op: watcher.Rename, OldPath: "/lmx/results/3.tmp"}, log)
+	q.done("/lmx/results/2.game", second, log)
+	// The file changed again before its first change was acknowledged.
+	changed := q.add(watcher.Event{Path: "/lmx/results/1.game", Op: watcher.Write}, log)
+	q.done("/lmx/results/1.game", first, log)
+	if err = q.close(); err != nil {
+		t.Fatalf("failed to close queue: %v", err)
+	}
+
+	// A crash can leave a torn last line behind.
+	wal := filepath.Join(dir, queueFileName)
+	file, err := os.OpenFile(wal, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("failed to open log: %v", err)
+	}
+	_, _ = file.WriteString(`{"id":7,"path":"/lmx/res`)
+	_ = file.Close()
+
+	q, records, err = openEventQueue(dir)
+	if err != nil {
+		t.Fatalf("failed to reopen queue: %v", err)
+	}
+	defer q.close()
+
+	if len(records) != 2 {
+		t.Fatalf("expected 2 unacknowledged events, got %+v", records)
+	}
+	if records[0].Path != "/lmx/results/3.game" || records[0].Op != "RENAME" || records[0].OldPath != "/lmx/results/3.tmp" {
+		t.Fatalf("expected the rename first, got %+v", records[0])
+	}
+	if records[1].Path != "/lmx/results/1.game" || records[1].ID != changed || records[1].Op != "WRITE" {
+		t.Fatalf("expected the latest change of 1.game, got %+v", records[1])
+	}
+
+	content, err := os.ReadFile(wal)
+	if err != nil {
+		t.Fatalf("failed to read log: %v", err)
+	}
+	if lines := bytes.Count(content, []byte("\n")); lines != 2 {
+		t.Fatalf("expected the log to be compacted to 2 records, got %d", lines)
+	}
+	if next := q.add(watcher.Event{Path: "/lmx/results/4.game", Op: watcher.Create}, log); next <= changed {
+		t.Fatalf("expected record ids to continue after %d, got %d", changed, next)
+	}
+}
+
+func TestRecoveredEventsAreDispatchedAndAcknowledged(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "result.game")
+	if err := os.WriteFile(path, []byte("content"), 0644); err != nil {
+		t.Fatalf("failed to write result file: %v", err)
+	}
+
+	queueDir := t.TempDir()
+	q, _, err := openEventQueue(queueDir)
+	if err != nil {
+		t.Fatalf("failed to open queue: %v", err)
+	}
+	q.add(watcher.Event{Path: path, Op: watcher.Create}, zap.NewNop())
+	q.add(watcher.Event{Path: filepath.Join(dir, "deleted.game"), Op: watcher.Create}, zap.NewNop())
+	_ = q.close()
+
+	cfg := &Config{
+		Dirs:     []string{dir},
+		Output:   "importer",
+		Sinks:    map[string]*SinkConfig{"importer": {Type: OutputHTTP, URL: server.URL}},
+		QueueDir: queueDir,
+	}
+	cfg.InitDefaults()
+	p := &Plugin{
+		cfg:   cfg,
+		log:   zap.NewNop(),
+		sinks: map[string]Sink{"importer": newTestHTTPSink(t, cfg.Sinks["importer"])},
+	}
+	p.metrics = newStatsExporter(p, nil)
+	if p.queue, p.recovered, err = openEventQueue(queueDir); err != nil {
+		t.Fatalf("failed to reopen queue: %v", err)
+	}
+	pending := make(map[string]*pendingFileEvent)
+	timers := newEventTimers()
+
+	p.pendingMu.Lock()
+	p.recoverEvents(pending, timers, p.recovered)
+	if len(pending) != 1 {
+		p.pendingMu.Unlock()
+		t.Fatalf("expected only the existing file to be recovered, got %d events", len(pending))
+	}
+	p.pendingMu.Unlock()
+
+	select {
+	case <-timers.C:
+		p.pendingMu.Lock()
+		for _, eventRef := range timers.due(time.Now()) {
+			p.dispatchPendingEvent(pending, timers, pending[eventRef.path])
+		}
+		p.closeQueue()
+		p.pendingMu.Unlock()
+	case <-time.After(time.Second):
+		t.Fatal("expected the recovered event to become ready")
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("expected the recovered event to be dispatched once, got %d", calls.Load())
+	}
+
+	q, records, err := openEventQueue(queueDir)
+	if err != nil {
+		t.Fatalf("failed to reopen queue: %v", err)
+	}
+	defer q.close()
+	if len(records) != 0 {
+		t.Fatalf("expected every recovered event to be acknowledged, got %+v", records)
+	}
+}
+
+func TestRecoveredRemoveIsReplayedFromTheLog(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "result.game")
+	written := filepath.Join(dir, "written.game")
+	for _, file := range []string{path, written} {
+		if err := os.WriteFile(file, []byte("content"), 0644); err != nil {
+			t.Fatalf("failed to write result file: %v", err)
+		}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat result file: %v", err)
+	}
+
+	queueDir := t.TempDir()
+	q, _, err := openEventQueue(queueDir)
+	if err != nil {
+		t.Fatalf("failed to open queue: %v", err)
+	}
+	q.add(watcher.Event{Path: path, Op: watcher.Remove, FileInfo: info}, zap.NewNop())
+	q.add(watcher.Event{Path: written, Op: watcher.Write}, zap.NewNop())
+	_ = q.close()
+	// Both files are gone before the restart.
+	_ = os.Remove(path)
+	_ = os.Remove(written)
+
+	p := &Plugin{cfg: &Config{Dirs: []string{dir}}, log: zap.NewNop()}
+	if p.queue, p.recovered, err = openEventQueue(queueDir); err != nil {
+		t.Fatalf("failed to reopen queue: %v", err)
+	}
+	defer p.closeQueue()
+	pending := make(map[string]*pendingFileEvent)
+	timers := newEventTimers()
+	defer timers.stop()
+
+	p.recoverEvents(pending, timers, p.recovered)
+	if _, ok := pending[written]; ok || len(pending) != 1 {
+		t.Fatalf("expected only the remove to be recovered, got %d events", len(pending))
+	}
+	removed, ok := pending[path]
+	if !ok || removed.event.Op != watcher.Remove {
+		t.Fatal("expected the remove of the missing file to be recovered")
+	}
+	if !removed.event.ModTime().Equal(info.ModTime()) || removed.event.Size() != info.Size() || removed.event.Name() != "result.game" {
+		t.Fatalf("expected the stored file info, got %s modified %s", removed.event.Name(), removed.event.ModTime())
+	}
+}
@@ -0,0 +1,84 @@
+package roadrunner
+
+import (
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// tokenBucket limits dispatches to rate events per second with bursts of up to
+// burst events. It is owned by the event loop and guarded by pendingMu.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket returns a full bucket, or nil when rate is 0.
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// reserve takes a token and returns how long the caller has to wait before using
+// it. Reservations drive the tokens below zero, so waiting events get their turns
+// in the order they reserved them. A nil bucket never waits.
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	if b == nil {
+		return 0
+	}
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+		b.last = now
+	}
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// newRateLimits returns the token buckets of the global and the per-watch rate
+// limits. The configuration is already validated.
+func newRateLimits(cfg *Config) (*tokenBucket, map[string]*tokenBucket) {
+	rate, _ := cfg.RatePerSecond()
+	global := newTokenBucket(rate, cfg.Burst)
+
+	watches := make(map[string]*tokenBucket)
+	for _, watch := range cfg.Watches {
+		watchRate, _ := watch.RatePerSecond()
+		if bucket := newTokenBucket(watchRate, watch.Burst); bucket != nil {
+			watches[filepath.Clean(watch.Dir)] = bucket
+		}
+	}
+	return global, watches
+}
+
+// limitEvent reserves a dispatch of the event under the global and the watch rate
+// limit. An event over a limit is held in pending until its turn and reported as
+// true; it is dispatched without another reservation when it becomes ready again.
+// The caller must hold pendingMu.
+func (p *Plugin) limitEvent(timers *eventTimers, pendingEvent *pendingFileEvent) bool {
+	if pendingEvent.limited {
+		pendingEvent.limited = false
+		return false
+	}
+
+	now := time.Now()
+	dir := p.watchedDirectoryForEvent(pendingEvent.event.Path)
+	delay := max(p.rateLimit.reserve(now), p.watchRateLimits[filepath.Clean(dir)].reserve(now))
+	if delay <= 0 {
+		return false
+	}
+
+	pendingEvent.limited = true
+	pendingEvent.held = false
+	pendingEvent.schedule(timers, delay)
+	p.metrics.CountRateLimited(dir)
+	p.log.Debug("dispatch rate limited", zap.String("path", pendingEvent.event.Path), zap.Duration("delay", delay))
+	return true
+}
@@ -0,0 +1,139 @@
+package roadrunner
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/radovskyb/watcher"
+	"go.uber.org/zap"
+)
+
+func TestTokenBucketReservesTurnsInOrder(t *testing.T) {
+	now := time.Now()
+	bucket := newTokenBucket(1, 2)
+	bucket.last = now
+
+	for i, want := range []time.Duration{0, 0, time.Second, 2 * time.Second} {
+		if got := bucket.reserve(now); got != want {
+			t.Fatalf("reservation %d: expected to wait %s, got %s", i, want, got)
+		}
+	}
+	// Three seconds later the two reservations are served and one token is back.
+	if got := bucket.reserve(now.Add(3 * time.Second)); got != 0 {
+		t.Fatalf("expected a refilled token, got a wait of %s", got)
+	}
+
+	var unlimited *tokenBucket
+	if got := unlimited.reserve(now); got != 0 {
+		t.Fatalf("expected no limit without a rate, got a wait of %s", got)
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	for rate, want := range map[string]float64{
+		"":        0,
+		"5/s":     5,
+		"300/m":   5,
+		"1800/h":  0.5,
+		"1/500ms": 2,
+		"2.5 / s": 2.5,
+	} {
+		got, err := parseRate(rate)
+		if err != nil || got != want {
+			t.Fatalf("%q: expected %v per second, got %v (%v)", rate, want, got, err)
+		}
+	}
+	for _, rate := range []string{"5", "five/s", "0/s", "-1/s", "5/day", "5/0s"} {
+		if _, err := parseRate(rate); err == nil {
+			t.Fatalf("expected %q to be rejected", rate)
+		}
+	}
+}
+
+func TestRateLimitHoldsEventsUntilTheirTurn(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	cfg := &Config{
+		Dirs:    []string{dir},
+		Output:  "importer",
+		Sinks:   map[string]*SinkConfig{"importer": {Type: OutputHTTP, URL: server.URL}},
+		Watches: []WatchConfig{{Dir: dir, Rate: "1/h"}},
+	}
+	cfg.InitDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected rate limit config to be valid: %v", err)
+	}
+	p := &Plugin{
+		cfg:   cfg,
+		log:   zap.NewNop(),
+		sinks: map[string]Sink{"importer": newTestHTTPSink(t, cfg.Sinks["importer"])},
+	}
+	p.rateLimit, p.watchRateLimits = newRateLimits(cfg)
+	p.metrics = newStatsExporter(p, nil)
+	pending := make(map[string]*pendingFileEvent)
+	timers := newEventTimers()
+
+	p.pendingMu.Lock()
+	defer p.pendingMu.Unlock()
+	var paths []string
+	for _, file := range []string{"1.game", "2.game"} {
+		path := filepath.Join(dir, file)
+		if err := os.WriteFile(path, []byte("content"), 0644); err != nil {
+			t.Fatalf("failed to write result file: %v", err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("failed to stat result file: %v", err)
+		}
+		p.dispatchPendingEvent(pending, timers, queueEvent(pending, watcher.Event{Path: path, Op: watcher.Create, FileInfo: info}))
+		paths = append(paths, path)
+	}
+
+	if calls.Load() != 1 {
+		t.Fatalf("expected only the burst to be dispatched, got %d requests", calls.Load())
+	}
+	limited, ok := pending[paths[1]]
+	if !ok || !limited.limited {
+		t.Fatal("expected the event over the rate limit to be held")
+	}
+	if wait := time.Until(limited.fireAt); wait < 59*time.Minute {
+		t.Fatalf("expected the held event to wait for its turn, got %s", wait)
+	}
+
+	// Its turn has come once the timer fires.
+	p.dispatchPendingEvent(pending, timers, limited)
+	if calls.Load() != 2 {
+		t.Fatalf("expected the held event to be dispatched on its turn, got %d requests", calls.Load())
+	}
+	if len(pending) != 0 {
+		t.Fatalf("expected no pending events, got %d", len(pending))
+	}
+}
+
+func TestConfigRejectsInvalidRateLimits(t *testing.T) {
+	for name, cfg := range map[string]*Config{
+		"invalid rate":        {Rate: "fast"},
+		"negative burst":      {Rate: "5/s", Burst: -1},
+		"burst without rate":  {Burst: 20},
+		"invalid watch rate":  {Watches: []WatchConfig{{Dir: "./lmx/results", Rate: "5/fortnight"}}},
+		"watch burst no rate": {Watches: []WatchConfig{{Dir: "./lmx/results", Burst: 5}}},
+	} {
+		cfg.Dir = t.TempDir()
+		cfg.InitDefaults()
+
+		if err := cfg.Validate(); err == nil {
+			t.Fatalf("expected %s to be rejected", name)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package roadrunner
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/radovskyb/watcher"
+	"github.com/roadrunner-server/errors"
+	"go.uber.org/zap"
+)
+
+// rescanJobsKept is how many finished rescan jobs are kept for RescanStatus.
+const rescanJobsKept = 100
+
+// rescanJob tracks the progress of one Rescan request.
+type rescanJob struct {
+	id      string
+	dir     string
+	started time.Time
+	total   int64
+
+	succeeded atomic.Int64
+	failed    atomic.Int64
+}
+
+// done records the final outcome of one replayed file.
+func (j *rescanJob) done(err error) {
+	if err != nil {
+		j.failed.Add(1)
+		return
+	}
+	j.succeeded.Add(1)
+}
+
+// finished reports whether every replayed file has an outcome.
+func (j *rescanJob) finished() bool {
+	return j.succeeded.Load()+j.failed.Load() >= j.total
+}
+
+func (j *rescanJob) report(out *RescanJob) {
+	out.ID = j.id
+	out.Dir = j.dir
+	out.Started = j.started.Format(time.RFC3339)
+	out.Total = j.total
+	out.Succeeded = j.succeeded.Load()
+	out.Failed = j.failed.Load()
+	out.Done = j.finished()
+}
+
+type rescanJobs struct {
+	mu   sync.RWMutex
+	jobs map[string]*rescanJob
+}
+
+func newRescanJobs() *rescanJobs {
+	return &rescanJobs{jobs: make(map[string]*rescanJob)}
+}
+
+// add adds job and evicts the oldest finished jobs beyond the rescanJobsKept most
+// recent ones. Running jobs are always kept.
+func (r *rescanJobs) add(job *rescanJob) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.jobs[job.id] = job
+
+	var finished []*rescanJob
+	for _, job := range r.jobs {
+		if job.finished() {
+			finished = append(finished, job)
+		}
+	}
+	if len(finished) <= rescanJobsKept {
+		return
+	}
+	slices.SortFunc(finished, func(a, b *rescanJob) int {
+		return b.started.Compare(a.started)
+	})
+	for _, job := range finished[rescanJobsKept:] {
+		delete(r.jobs, job.id)
+	}
+}
+
+func (r *rescanJobs) get(id string) (*rescanJob, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	job, ok := r.jobs[id]
+	return job, ok
+}
+
+// rescanFilter selects the files a rescan replays.
+type rescanFilter struct {
+	// glob is matched against the file name. Empty matches every file.
+	glob string
+	// regexp is the configured file_watch regexp, so a rescan never replays files
+	// the watcher would not report. Nil matches every file.
+	regexp *regexp.Regexp
+	// since and until bound the modification time, since inclusive and until
+	// exclusive. Zero values are unbounded.
+	since time.Time
+	until time.Time
+}
+
+func (f rescanFilter) match(info os.FileInfo) bool {
+	if info.IsDir() {
+		return false
+	}
+	if f.glob != "" {
+		if ok, _ := filepath.Match(f.glob, info.Name()); !ok {
+			return false
+		}
+	}
+	if f.regexp != nil && !f.regexp.MatchString(info.Name()) {
+		return false
+	}
+	if !f.since.IsZero() && info.ModTime().Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && !info.ModTime().Before(f.until) {
+		return false
+	}
+	return true
+}
+
+// findReplayEvents lists the files in dir that match the filter as REPLAY events,
+// oldest first so results are re-imported in the order they were written.
+func findReplayEvents(dir string, filter rescanFilter) ([]watcher.Event, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]watcher.Event, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			// The file was removed while the directory was listed.
+			continue
+		}
+		if !filter.match(info) {
+			continue
+		}
+		events = append(events, watcher.Event{
+			Op:       opReplay,
+			Path:     filepath.Join(dir, entry.Name()),
+			FileInfo: info,
+		})
+	}
+
+	slices.SortStableFunc(events, func(a, b watcher.Event) int {
+		return a.ModTime().Compare(b.ModTime())
+	})
+	return events, nil
+}
+
+// rescan replays the matching files of a watched directory through the event
+// loop and returns the job tracking their dispatch.
+func (p *Plugin) rescan(dir string, filter rescanFilter) (*rescanJob, error) {
+	const op = errors.Op("file_watch_rescan")
+	if dir == "" {
+		return nil, errors.E(op, errors.Str("directory is required"))
+	}
+	if filter.glob != "" {
+		if _, err := filepath.Match(filter.glob, ""); err != nil {
+			return nil, errors.E(op, err)
+		}
+	}
+
+	p.mu.RLock()
+	replays := p.replayCh
+	stopCh := p.stopCh
+	running := p.watcher != nil
+	watched := containsDir(p.cfg.WatchDirs(), filepath.Clean(dir))
+	if p.cfg.Regexp != "" {
+		filter.regexp = regexp.MustCompile(p.cfg.Regexp)
+	}
+	p.mu.RUnlock()
+
+	if !running {
+		return nil, errors.E(op, errors.Str("file watcher is not running"))
+	}
+	if !watched {
+		return nil, errors.E(op, errors.Errorf("directory %q is not watched", dir))
+	}
+
+	events, err := findReplayEvents(dir, filter)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+
+	job := &rescanJob{
+		id:      uuid.NewString(),
+		dir:     dir,
+		started: time.Now(),
+		total:   int64(len(events)),
+	}
+	p.rescans.add(job)
+	p.log.Info("rescan started", zap.String("job", job.id), zap.String("dir", dir), zap.Int64("files", job.total))
+
+	go func() {
+		for _, event := range events {
+			select {
+			case replays <- replayEvent{event: event, job: job}:
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+
+	return job, nil
+}
@@ -0,0 +1,163 @@
+package roadrunner
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/radovskyb/watcher"
+	"go.uber.org/zap"
+)
+
+func writeFileWithModTime(t *testing.T, path string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte("content"), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("failed to set mod time of %s: %v", path, err)
+	}
+}
+
+func TestFindReplayEventsFiltersByGlobAndTime(t *testing.T) {
+	dir := t.TempDir()
+	day := time.Date(2026, 5, 8, 0, 0, 0, 0, time.UTC)
+	writeFileWithModTime(t, filepath.Join(dir, "late.game"), day.Add(20*time.Hour))
+	writeFileWithModTime(t, filepath.Join(dir, "early.game"), day.Add(10*time.Hour))
+	writeFileWithModTime(t, filepath.Join(dir, "previous.game"), day.Add(-time.Hour))
+	writeFileWithModTime(t, filepath.Join(dir, "notes.txt"), day.Add(12*time.Hour))
+	if err := os.Mkdir(filepath.Join(dir, "archive.game"), 0755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+
+	events, err := findReplayEvents(dir, rescanFilter{glob: "*.game", since: day, until: day.Add(24 * time.Hour)})
+	if err != nil {
+		t.Fatalf("findReplayEvents returned error: %v", err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("expected two matching files, got %d", len(events))
+	}
+	if events[0].Path != filepath.Join(dir, "early.game") || events[1].Path != filepath.Join(dir, "late.game") {
+		t.Fatalf("expected files oldest first, got %q and %q", events[0].Path, events[1].Path)
+	}
+	for _, event := range events {
+		if event.Op != opReplay {
+			t.Fatalf("expected REPLAY op, got %s", opName(event.Op))
+		}
+	}
+}
+
+func TestRescanQueuesReplayEvents(t *testing.T) {
+	dir := t.TempDir()
+	writeFileWithModTime(t, filepath.Join(dir, "0001.game"), time.Now())
+
+	p := &Plugin{
+		cfg:      &Config{Dirs: []string{dir}},
+		log:      zap.NewNop(),
+		watcher:  watcher.New(),
+		replayCh: make(chan replayEvent, 1),
+		stopCh:   make(chan struct{}),
+		rescans:  newRescanJobs(),
+	}
+
+	job, err := p.rescan(dir, rescanFilter{})
+	if err != nil {
+		t.Fatalf("rescan returned error: %v", err)
+	}
+	if job.total != 1 {
+		t.Fatalf("expected one file to be queued, got %d", job.total)
+	}
+	if found, ok := p.rescans.get(job.id); !ok || found != job {
+		t.Fatal("expected job to be tracked by ID")
+	}
+
+	select {
+	case replay := <-p.replayCh:
+		if replay.job != job || replay.event.Path != filepath.Join(dir, "0001.game") {
+			t.Fatalf("unexpected replay event %#v", replay)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for replay event")
+	}
+
+	var out RescanJob
+	job.done(nil)
+	job.report(&out)
+	if !out.Done || out.Succeeded != 1 {
+		t.Fatalf("expected finished job, got %#v", out)
+	}
+}
+
+func TestRescanRejectsUnwatchedDirectory(t *testing.T) {
+	p := &Plugin{
+		cfg:     &Config{Dirs: []string{t.TempDir()}},
+		log:     zap.NewNop(),
+		watcher: watcher.New(),
+		rescans: newRescanJobs(),
+	}
+
+	if _, err := p.rescan(t.TempDir(), rescanFilter{}); err == nil {
+		t.Fatal("expected rescan of an unwatched directory to fail")
+	}
+}
+
+func TestRescanJobsEvictOldestFinishedJobs(t *testing.T) {
+	jobs := newRescanJobs()
+	started := time.Now()
+	running := &rescanJob{id: "running", started: started.Add(-time.Hour), total: 1}
+	jobs.add(running)
+	for i := range rescanJobsKept + 2 {
+		jobs.add(&rescanJob{id: strconv.Itoa(i), started: started.Add(time.Duration(i) * time.Second)})
+	}
+
+	if len(jobs.jobs) != rescanJobsKept+1 {
+		t.Fatalf("expected %d kept jobs, got %d", rescanJobsKept+1, len(jobs.jobs))
+	}
+	if _, ok := jobs.get("running"); !ok {
+		t.Fatal("expected the running job to be kept")
+	}
+	for id, kept := range map[string]bool{"0": false, "1": false, "2": true, strconv.Itoa(rescanJobsKept + 1): true} {
+		if _, ok := jobs.get(id); ok != kept {
+			t.Fatalf("expected job %s kept=%v", id, kept)
+		}
+	}
+}
+
+func TestRenamedReplayFinishesItsRescanJob(t *testing.T) {
+	dir := t.TempDir()
+	oldPath := filepath.Join(dir, "a.tmp")
+	path := filepath.Join(dir, "a.game")
+	writeFileWithModTime(t, path, time.Now())
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat result file: %v", err)
+	}
+
+	// Without a worker pool every dispatch fails.
+	p := &Plugin{cfg: &Config{MaxAttempts: 1}, log: zap.NewNop()}
+	p.metrics = newStatsExporter(p, nil)
+	pending := make(map[string]*pendingFileEvent)
+	timers := newEventTimers()
+	defer timers.stop()
+	job := &rescanJob{id: "rename", total: 1}
+
+	// The replayed file is still pending, held or limited, when it is renamed.
+	replayed := queueEvent(pending, watcher.Event{Path: oldPath, Op: opReplay, FileInfo: info})
+	replayed.jobs = append(replayed.jobs, job)
+	p.pendingMu.Lock()
+	defer p.pendingMu.Unlock()
+	p.queueFileEvent(pending, timers, nil, watcher.Event{Path: path, OldPath: oldPath, Op: watcher.Rename, FileInfo: info}, 0, time.Hour)
+
+	renamed, ok := pending[path]
+	if _, stale := pending[oldPath]; stale || !ok {
+		t.Fatal("expected the rename to replace the pending replay")
+	}
+	p.dispatchPendingEvent(pending, timers, renamed)
+
+	if !job.finished() || job.failed.Load() != 1 {
+		t.Fatalf("expected the rescan job to finish with the renamed file, got %d failed", job.failed.Load())
+	}
+}
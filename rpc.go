@@ -0,0 +1,239 @@
+package roadrunner
+
+import (
+	"time"
+
+	"github.com/roadrunner-server/errors"
+)
+
+// WatchRequest selects a watch directory for AddWatch and RemoveWatch.
+type WatchRequest struct {
+	Dir string `json:"dir"`
+	// Persist records the change in the configured state file so it survives restarts.
+	Persist bool `json:"persist"`
+}
+
+// WatchList is the list of currently watched directories.
+type WatchList struct {
+	Dirs []string `json:"dirs"`
+	// Missing lists configured directories that do not exist yet and are checked again periodically.
+	Missing []string `json:"missing,omitempty"`
+}
+
+// DispatchStatus reports whether event dispatch is paused.
+type DispatchStatus struct {
+	Paused bool `json:"paused"`
+	// Held is the number of events waiting for Resume.
+	Held int64 `json:"held"`
+}
+
+// RescanRequest selects the files of a watched directory to replay.
+type RescanRequest struct {
+	Dir string `json:"dir"`
+	// Glob is matched against file names, for example "*.game". Empty matches every file.
+	Glob string `json:"glob"`
+	// Since and Until bound the file modification time as RFC 3339 timestamps.
+	// Since is inclusive, Until is exclusive, and empty values are unbounded.
+	Since string `json:"since"`
+	Until string `json:"until"`
+}
+
+// RescanJob reports the progress of a rescan.
+type RescanJob struct {
+	ID      string `json:"id"`
+	Dir     string `json:"dir"`
+	Started string `json:"started"`
+	// Total is the number of files queued for replay.
+	Total     int64 `json:"total"`
+	Succeeded int64 `json:"succeeded"`
+	Failed    int64 `json:"failed"`
+	// Done is set once every queued file succeeded or failed for good.
+	Done bool `json:"done"`
+}
+
+// PendingEvent is an event waiting in the debounce queue.
+type PendingEvent struct {
+	Path string `json:"path"`
+	// Op is the operation of the latest event coalesced for the path.
+	Op  string `json:"op"`
+	Seq uint64 `json:"seq"`
+	// FireAt is when the event becomes ready for dispatch (RFC 3339).
+	FireAt string `json:"fireAt"`
+	// Attempt is the number of failed dispatches so far.
+	Attempt int `json:"attempt"`
+	// Held is set for events that are ready but held while dispatch is paused.
+	Held bool `json:"held"`
+}
+
+// PendingList is the content of the debounce queue.
+type PendingList struct {
+	Events []PendingEvent `json:"events"`
+}
+
+// InFlightDispatch is an event currently executed by a worker.
+type InFlightDispatch struct {
+	Path    string `json:"path"`
+	Op      string `json:"op"`
+	Attempt int    `json:"attempt"`
+	Started string `json:"started"`
+	// WorkerPID is only set when the executing worker can be determined unambiguously.
+	WorkerPID int64 `json:"workerPid,omitempty"`
+}
+
+// InFlightList lists the events currently executed by workers.
+type InFlightList struct {
+	Dispatches []InFlightDispatch `json:"dispatches"`
+	// WorkingPIDs are the PIDs of all workers in the working state.
+	WorkingPIDs []int64 `json:"workingPids"`
+}
+
+// DispatchRequest selects a file to send to a worker right away.
+type DispatchRequest struct {
+	Path string `json:"path"`
+	// Op is sent to the worker: CREATE, WRITE or REPLAY. Empty means WRITE.
+	Op string `json:"op"`
+}
+
+// DispatchResult is the classified worker result of a manual dispatch.
+type DispatchResult struct {
+	Path string `json:"path"`
+	Op   string `json:"op"`
+	// OK is set when the worker answered OK.
+	OK bool `json:"ok"`
+	// Error describes why the dispatch failed, for example a worker ERROR response or a timeout.
+	Error     string `json:"error,omitempty"`
+	ElapsedMs int64  `json:"elapsedMs"`
+}
+
+// HealthReport explains the status code reported by Status and Ready.
+type HealthReport struct {
+	Code int `json:"code"`
+	// Reasons lists every failed check. It is empty when the plugin is healthy.
+	Reasons []HealthReason `json:"reasons,omitempty"`
+}
+
+// HealthReason is a failed health check.
+type HealthReason struct {
+	// Check is one of workers, watcher, dirs, stale, error_rate or circuit.
+	Check string `json:"check"`
+	Dir   string `json:"dir,omitempty"`
+	// Target is the sink of a circuit check.
+	Target string `json:"target,omitempty"`
+	// Degraded is set for checks that only degrade the plugin. Any other failed check
+	// makes it unavailable.
+	Degraded bool   `json:"degraded"`
+	Message  string `json:"message"`
+}
+
+type rpc struct {
+	p *Plugin
+}
+
+// RPC returns the RPC service registered by RoadRunner's RPC plugin under the plugin name.
+func (p *Plugin) RPC() any {
+	return &rpc{p: p}
+}
+
+// AddWatch starts watching a directory without restarting the plugin.
+func (r *rpc) AddWatch(in *WatchRequest, out *WatchList) error {
+	if err := r.p.addWatch(in.Dir, in.Persist); err != nil {
+		return err
+	}
+	out.Dirs, out.Missing = r.p.listWatches()
+	return nil
+}
+
+// RemoveWatch stops watching a directory without restarting the plugin.
+func (r *rpc) RemoveWatch(in *WatchRequest, out *WatchList) error {
+	if err := r.p.removeWatch(in.Dir, in.Persist); err != nil {
+		return err
+	}
+	out.Dirs, out.Missing = r.p.listWatches()
+	return nil
+}
+
+// ListWatches returns the directories currently watched.
+func (r *rpc) ListWatches(_ bool, out *WatchList) error {
+	out.Dirs, out.Missing = r.p.listWatches()
+	return nil
+}
+
+// Pause stops dispatching events to workers. Events keep being detected and are
+// held until Resume is called.
+func (r *rpc) Pause(_ bool, out *DispatchStatus) error {
+	r.p.pause()
+	return r.Status(true, out)
+}
+
+// Resume dispatches the held events and continues normal dispatch.
+func (r *rpc) Resume(_ bool, out *DispatchStatus) error {
+	r.p.resume()
+	return r.Status(true, out)
+}
+
+// Status reports whether event dispatch is paused and how many events are held.
+func (r *rpc) Status(_ bool, out *DispatchStatus) error {
+	out.Paused = r.p.paused.Load()
+	out.Held = r.p.held.Load()
+	return nil
+}
+
+// Rescan replays matching files of a watched directory to the workers with op REPLAY.
+func (r *rpc) Rescan(in *RescanRequest, out *RescanJob) error {
+	const op = errors.Op("file_watch_rpc_rescan")
+	filter := rescanFilter{glob: in.Glob}
+
+	var err error
+	if in.Since != "" {
+		if filter.since, err = time.Parse(time.RFC3339, in.Since); err != nil {
+			return errors.E(op, err)
+		}
+	}
+	if in.Until != "" {
+		if filter.until, err = time.Parse(time.RFC3339, in.Until); err != nil {
+			return errors.E(op, err)
+		}
+	}
+
+	job, err := r.p.rescan(in.Dir, filter)
+	if err != nil {
+		return err
+	}
+	job.report(out)
+	return nil
+}
+
+// RescanStatus returns the progress of a rescan job by ID.
+func (r *rpc) RescanStatus(id string, out *RescanJob) error {
+	job, ok := r.p.rescans.get(id)
+	if !ok {
+		return errors.E(errors.Op("file_watch_rpc_rescan_status"), errors.Errorf("rescan job %q not found", id))
+	}
+	job.report(out)
+	return nil
+}
+
+// Pending lists the events waiting in the debounce queue, including retries and
+// events held while paused.
+func (r *rpc) Pending(_ bool, out *PendingList) error {
+	out.Events = r.p.pendingEvents()
+	return nil
+}
+
+// InFlight lists the events currently executed by workers.
+func (r *rpc) InFlight(_ bool, out *InFlightList) error {
+	out.Dispatches, out.WorkingPIDs = r.p.inFlightEvents()
+	return nil
+}
+
+// Dispatch sends a single file inside a watched directory to a worker, bypassing
+// debounce, and waits for the worker result.
+func (r *rpc) Dispatch(in *DispatchRequest, out *DispatchResult) error {
+	return r.p.dispatchFile(in.Path, in.Op, out)
+}
+
+// Health explains the status code of Status, or of Ready with ready set.
+func (r *rpc) Health(ready bool, out *HealthReport) error {
+	*out = *r.p.health(ready)
+	return nil
+}
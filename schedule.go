@@ -0,0 +1,211 @@
+package roadrunner
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/roadrunner-server/errors"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// activeSchedule holds the hours during which a watch directory is expected to
+// receive files. Silence outside of them does not make the directory stale.
+type activeSchedule struct {
+	ranges []activeRange
+	loc    *time.Location
+}
+
+// activeRange is a time range on some weekdays. Times are minutes after midnight.
+// A range that ends before it starts runs past midnight into the next day.
+type activeRange struct {
+	days  [7]bool
+	start int
+	end   int
+}
+
+// parseActiveSchedule parses ranges such as "mon-fri 14:00-23:00", "sat,sun 10:00-02:00"
+// or "18:00-22:00" (every day) in the named time zone. Empty tz means local time.
+func parseActiveSchedule(ranges []string, tz string) (*activeSchedule, error) {
+	loc := time.Local
+	if tz != "" {
+		var err error
+		loc, err = time.LoadLocation(tz)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	schedule := &activeSchedule{loc: loc}
+	for _, spec := range ranges {
+		r, err := parseActiveRange(spec)
+		if err != nil {
+			return nil, err
+		}
+		schedule.ranges = append(schedule.ranges, r)
+	}
+	return schedule, nil
+}
+
+func parseActiveRange(spec string) (activeRange, error) {
+	var r activeRange
+	fields := strings.Fields(strings.ToLower(spec))
+	var days, hours string
+	switch len(fields) {
+	case 1:
+		days, hours = "*", fields[0]
+	case 2:
+		days, hours = fields[0], fields[1]
+	default:
+		return r, errors.Errorf("active_hours entry %q must be \"[days] HH:MM-HH:MM\"", spec)
+	}
+
+	for _, part := range strings.Split(days, ",") {
+		if part == "*" {
+			for day := range r.days {
+				r.days[day] = true
+			}
+			continue
+		}
+		from, to, isRange := strings.Cut(part, "-")
+		first, ok := weekdays[from]
+		if !ok {
+			return r, errors.Errorf("active_hours entry %q has unknown weekday %q", spec, from)
+		}
+		last := first
+		if isRange {
+			if last, ok = weekdays[to]; !ok {
+				return r, errors.Errorf("active_hours entry %q has unknown weekday %q", spec, to)
+			}
+		}
+		// Ranges such as fri-mon wrap around the end of the week.
+		for day := first; ; day = (day + 1) % 7 {
+			r.days[day] = true
+			if day == last {
+				break
+			}
+		}
+	}
+
+	from, to, ok := strings.Cut(hours, "-")
+	if !ok {
+		return r, errors.Errorf("active_hours entry %q must be \"[days] HH:MM-HH:MM\"", spec)
+	}
+	var err error
+	if r.start, err = parseClock(from); err != nil || r.start == 24*60 {
+		return r, errors.Errorf("active_hours entry %q has invalid start time %q", spec, from)
+	}
+	if r.end, err = parseClock(to); err != nil {
+		return r, errors.Errorf("active_hours entry %q has invalid end time %q", spec, to)
+	}
+	if r.start == r.end {
+		return r, errors.Errorf("active_hours entry %q is empty", spec)
+	}
+	return r, nil
+}
+
+// parseClock parses HH:MM into minutes after midnight. 24:00 is accepted as the end of the day.
+func parseClock(clock string) (int, error) {
+	h, m, ok := strings.Cut(clock, ":")
+	if !ok {
+		return 0, errors.Str("missing colon")
+	}
+	hour, err := strconv.Atoi(h)
+	if err != nil {
+		return 0, err
+	}
+	minute, err := strconv.Atoi(m)
+	if err != nil {
+		return 0, err
+	}
+	if hour < 0 || minute < 0 || minute > 59 || hour > 24 || (hour == 24 && minute != 0) {
+		return 0, errors.Str("out of range")
+	}
+	return hour*60 + minute, nil
+}
+
+// active reports whether t is inside one of the ranges. A nil schedule is always active.
+func (s *activeSchedule) active(t time.Time) bool {
+	if s == nil {
+		return true
+	}
+	t = t.In(s.loc)
+	// A range that started yesterday can still run past midnight.
+	for _, day := range []time.Time{startOfDay(t).AddDate(0, 0, -1), startOfDay(t)} {
+		for _, r := range s.ranges {
+			start, end, ok := r.on(day)
+			if ok && !t.Before(start) && t.Before(end) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// activeBetween returns how much of the time between from and to lies inside the
+// ranges. It stops counting once limit is exceeded. A nil schedule counts everything.
+func (s *activeSchedule) activeBetween(from, to time.Time, limit time.Duration) time.Duration {
+	if s == nil {
+		return to.Sub(from)
+	}
+
+	var total time.Duration
+	from, to = from.In(s.loc), to.In(s.loc)
+	for day := startOfDay(from).AddDate(0, 0, -1); day.Before(to) && total <= limit; day = day.AddDate(0, 0, 1) {
+		for _, r := range s.ranges {
+			start, end, ok := r.on(day)
+			if !ok {
+				continue
+			}
+			start, end = later(start, from), earlier(end, to)
+			if end.After(start) {
+				total += end.Sub(start)
+			}
+		}
+	}
+	return total
+}
+
+// on returns the start and end of the range on day, if the range applies to that weekday.
+func (r activeRange) on(day time.Time) (time.Time, time.Time, bool) {
+	if !r.days[day.Weekday()] {
+		return time.Time{}, time.Time{}, false
+	}
+	start := atMinute(day, r.start)
+	if r.end <= r.start {
+		return start, atMinute(day.AddDate(0, 0, 1), r.end), true
+	}
+	return start, atMinute(day, r.end), true
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// atMinute builds the wall clock time on day, so ranges follow daylight saving changes.
+func atMinute(day time.Time, minute int) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), minute/60, minute%60, 0, 0, day.Location())
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func earlier(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,60 @@
+package roadrunner
+
+import (
+	"testing"
+	"time"
+)
+
+func TestActiveScheduleHonoursWeekdaysAndOvernightRanges(t *testing.T) {
+	schedule, err := parseActiveSchedule([]string{"mon-fri 14:00-23:00", "sat,sun 10:00-02:00"}, "Europe/Prague")
+	if err != nil {
+		t.Fatalf("parseActiveSchedule returned error: %v", err)
+	}
+	loc := schedule.loc
+
+	cases := []struct {
+		at     time.Time
+		active bool
+	}{
+		{time.Date(2026, time.October, 19, 15, 0, 0, 0, loc), true},   // Monday afternoon
+		{time.Date(2026, time.October, 19, 23, 30, 0, 0, loc), false}, // Monday night
+		{time.Date(2026, time.October, 24, 9, 0, 0, 0, loc), false},   // Saturday morning
+		{time.Date(2026, time.October, 25, 1, 30, 0, 0, loc), true},   // Saturday's range past midnight
+		{time.Date(2026, time.October, 26, 1, 30, 0, 0, loc), true},   // Sunday's range past midnight
+		{time.Date(2026, time.October, 27, 1, 30, 0, 0, loc), false},  // Monday's range ends at 23:00
+	}
+	for _, c := range cases {
+		if got := schedule.active(c.at); got != c.active {
+			t.Fatalf("active(%s) = %v, want %v", c.at, got, c.active)
+		}
+	}
+}
+
+func TestActiveScheduleCountsOnlyActiveTime(t *testing.T) {
+	schedule, err := parseActiveSchedule([]string{"14:00-23:00"}, "UTC")
+	if err != nil {
+		t.Fatalf("parseActiveSchedule returned error: %v", err)
+	}
+
+	from := time.Date(2026, time.October, 19, 22, 0, 0, 0, time.UTC)
+	to := time.Date(2026, time.October, 20, 15, 0, 0, 0, time.UTC)
+	if got := schedule.activeBetween(from, to, 24*time.Hour); got != 2*time.Hour {
+		t.Fatalf("expected two active hours overnight, got %s", got)
+	}
+
+	var always *activeSchedule
+	if !always.active(from) || always.activeBetween(from, to, time.Hour) != to.Sub(from) {
+		t.Fatal("expected a nil schedule to be always active")
+	}
+}
+
+func TestActiveScheduleRejectsInvalidRanges(t *testing.T) {
+	for _, spec := range []string{"", "mon", "funday 10:00-12:00", "mon 10-12", "mon 10:00-25:00", "mon 10:00-10:00", "mon fri 10:00-12:00"} {
+		if _, err := parseActiveSchedule([]string{spec}, ""); err == nil {
+			t.Fatalf("expected %q to be rejected", spec)
+		}
+	}
+	if _, err := parseActiveSchedule([]string{"10:00-12:00"}, "Mars/Olympus_Mons"); err == nil {
+		t.Fatal("expected an unknown time zone to be rejected")
+	}
+}
@@ -0,0 +1,342 @@
+package roadrunner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	rrErrors "github.com/roadrunner-server/errors"
+	"github.com/roadrunner-server/pool/payload"
+)
+
+// Sink delivers the payload of a file event or a batch of them. A nil error means
+// the payload was processed; failures are tagged with dispatchFailure where the
+// sink knows why. The returned response may acknowledge the items of a batch.
+type Sink interface {
+	Deliver(ctx context.Context, pld *payload.Payload) ([]byte, error)
+	Close() error
+}
+
+// newSink creates the sink for cfg. Pool sinks execute on the plugin's worker pool.
+func (p *Plugin) newSink(cfg *SinkConfig) (Sink, error) {
+	switch cfg.Type {
+	case OutputJobs:
+		return newJobsSink(cfg.Jobs, p), nil
+	case OutputHTTP:
+		return newHTTPSink(cfg)
+	case OutputExec:
+		return newExecSink(cfg.Command), nil
+	case OutputSocket:
+		return newSocketSink(cfg.Socket), nil
+	default:
+		return &poolSink{p: p}, nil
+	}
+}
+
+// sink returns the named sink. Without configured sinks events go to the worker pool.
+func (p *Plugin) sink(name string) Sink {
+	if sink, ok := p.sinks[name]; ok {
+		return sink
+	}
+	return &poolSink{p: p}
+}
+
+// carrierHeaders returns the W3C trace context stored as JSON in the payload context.
+func carrierHeaders(pld *payload.Payload) map[string]string {
+	if len(pld.Context) == 0 {
+		return nil
+	}
+	var carrier map[string]string
+	if err := json.Unmarshal(pld.Context, &carrier); err != nil {
+		return nil
+	}
+	return carrier
+}
+
+// poolSink executes events on the plugin's worker pool.
+type poolSink struct {
+	p *Plugin
+}
+
+func (s *poolSink) Deliver(ctx context.Context, pld *payload.Payload) ([]byte, error) {
+	// Protect from pool reset while Exec is using the pool.
+	s.p.mu.RLock()
+	pool := s.p.workersPool
+	if pool == nil {
+		s.p.mu.RUnlock()
+		return nil, rrErrors.Str("worker pool is not initialized")
+	}
+	responses, execErr := pool.Exec(ctx, pld, nil)
+	s.p.mu.RUnlock()
+
+	if execErr != nil {
+		return nil, execErr
+	}
+
+	if isBatchPayload(pld) {
+		return receiveBatchResponse(ctx, responses)
+	}
+	return nil, classifyWorkerResponse(ctx, responses)
+}
+
+func (s *poolSink) Close() error {
+	// The plugin owns the pool.
+	return nil
+}
+
+// maxResponseSize limits how much of a webhook response is read.
+const maxResponseSize = 1 << 20
+
+// Headers of signed webhook requests. The signature is the hex HMAC-SHA256 of the
+// timestamp, a dot and the body, so receivers can reject replayed requests.
+const (
+	headerTimestamp = "X-File-Watch-Timestamp"
+	headerSignature = "X-File-Watch-Signature"
+)
+
+// httpSink posts the event JSON to a webhook. Status codes are answered like a
+// worker: 2xx is OK, 4xx is ERROR and 5xx is a broken worker.
+type httpSink struct {
+	url     string
+	secret  []byte
+	headers map[string]string
+	client  *http.Client
+}
+
+func newHTTPSink(cfg *SinkConfig) (*httpSink, error) {
+	var err error
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.TLS != nil {
+		if transport.TLSClientConfig, err = sinkTLSConfig(cfg.TLS); err != nil {
+			return nil, err
+		}
+	}
+
+	sink := &httpSink{
+		url:     cfg.URL,
+		headers: cfg.Headers,
+		client: &http.Client{
+			Transport: transport,
+			// Redirects are answered as unexpected responses instead of being followed.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+	if cfg.SecretEnv != "" {
+		sink.secret = []byte(os.Getenv(cfg.SecretEnv))
+	}
+	return sink, nil
+}
+
+func sinkTLSConfig(cfg *SinkTLSConfig) (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify, //nolint:gosec
+	}
+	if cfg.CA != "" {
+		pem, err := os.ReadFile(cfg.CA)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.RootCAs = x509.NewCertPool()
+		if !tlsCfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, rrErrors.Errorf("no certificates found in %s", cfg.CA)
+		}
+	}
+	if cfg.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.Cert, cfg.Key)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return tlsCfg, nil
+}
+
+// Deliver posts the payload within the deadline of ctx, which the sink's timeout sets.
+func (s *httpSink) Deliver(ctx context.Context, pld *payload.Payload) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(pld.Body))
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range s.headers {
+		req.Header.Set(key, value)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range carrierHeaders(pld) {
+		req.Header.Set(key, value)
+	}
+	if s.secret != nil {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(headerTimestamp, timestamp)
+		req.Header.Set(headerSignature, "sha256="+signPayload(s.secret, timestamp, pld.Body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if statusErr := classifyHTTPStatus(resp); statusErr != nil {
+		return nil, statusErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func (s *httpSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// signPayload returns the hex HMAC-SHA256 of timestamp, a dot and body.
+func signPayload(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// classifyHTTPStatus maps webhook responses onto the worker classification. Other
+// 4xx responses than 408 and 429 are not retried, since the webhook rejected the event.
+func classifyHTTPStatus(resp *http.Response) error {
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+		return nil
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests:
+		return &dispatchFailure{reason: failureWorkerError, err: rrErrors.Errorf("webhook returned %s", resp.Status)}
+	case resp.StatusCode >= 400 && resp.StatusCode <= 499:
+		return &dispatchFailure{reason: failureWorkerError, err: rrErrors.Errorf("webhook rejected the event with %s", resp.Status), permanent: true}
+	case resp.StatusCode >= 500 && resp.StatusCode <= 599:
+		return &dispatchFailure{reason: failureTransport, err: rrErrors.Errorf("webhook failed with %s", resp.Status)}
+	default:
+		return &dispatchFailure{reason: failureUnexpectedResponse, err: rrErrors.Errorf("webhook returned unexpected %s", resp.Status)}
+	}
+}
+
+// execSink runs a command for every event with the event JSON on stdin. Exit
+// code 0 means the event was processed.
+type execSink struct {
+	command []string
+}
+
+func newExecSink(command []string) *execSink {
+	return &execSink{command: command}
+}
+
+func (s *execSink) Deliver(ctx context.Context, pld *payload.Payload) ([]byte, error) {
+	const op = rrErrors.Op("file_watch_exec_sink")
+
+	cmd := exec.CommandContext(ctx, s.command[0], s.command[1:]...) //nolint:gosec
+	cmd.Stdin = bytes.NewReader(pld.Body)
+	cmd.Env = append(os.Environ(), RrMode+"="+RrModeFileWatch)
+	// Commands continue the trace through the TRACEPARENT and TRACESTATE variables.
+	for key, value := range carrierHeaders(pld) {
+		cmd.Env = append(cmd.Env, strings.ToUpper(key)+"="+value)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return nil, rrErrors.E(op, rrErrors.ExecTTL, ctx.Err())
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return nil, &dispatchFailure{reason: failureWorkerError, err: rrErrors.Errorf("command exited with code %d: %s", exitErr.ExitCode(), strings.TrimSpace(stderr.String()))}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+func (s *execSink) Close() error {
+	return nil
+}
+
+// socketSink writes the event JSON as one line to a Unix socket and reads one
+// line back, which is answered like a worker response: OK or ERROR.
+type socketSink struct {
+	path string
+}
+
+func newSocketSink(path string) *socketSink {
+	return &socketSink{path: path}
+}
+
+func (s *socketSink) Deliver(ctx context.Context, pld *payload.Payload) ([]byte, error) {
+	const op = rrErrors.Op("file_watch_socket_sink")
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if _, err = conn.Write(append(bytes.Clone(pld.Body), '\n')); err != nil {
+		return nil, socketError(op, err)
+	}
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil && (!errors.Is(err, io.EOF) || len(line) == 0) {
+		if errors.Is(err, io.EOF) {
+			return nil, &dispatchFailure{reason: failureNoResponse, err: rrErrors.Str("socket closed without response")}
+		}
+		return nil, socketError(op, err)
+	}
+	if isBatchPayload(pld) {
+		if acks, ok := batchAcksBody(socketResponse(line)); ok {
+			return acks, nil
+		}
+	}
+	return nil, classifyWorkerExecutionResponse(socketResponse(line))
+}
+
+func (s *socketSink) Close() error {
+	return nil
+}
+
+// socketError reports socket deadlines as timeouts.
+func socketError(op rrErrors.Op, err error) error {
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return rrErrors.E(op, rrErrors.ExecTTL, err)
+	}
+	return err
+}
+
+// socketResponse is a response line read from a socket sink.
+type socketResponse []byte
+
+func (r socketResponse) Body() []byte {
+	return r
+}
+
+func (r socketResponse) Error() error {
+	return nil
+}
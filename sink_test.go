@@ -0,0 +1,334 @@
+package roadrunner
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/radovskyb/watcher"
+	"github.com/roadrunner-server/pool/payload"
+	"go.uber.org/zap"
+)
+
+var sinkPayload = &payload.Payload{
+	Body:    []byte(`{"path":"./lmx/results/0001.game"}`),
+	Context: []byte(`{"traceparent":"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}`),
+}
+
+func newTestHTTPSink(t *testing.T, cfg *SinkConfig) *httpSink {
+	t.Helper()
+	cfg.Type = OutputHTTP
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected http sink config to be valid: %v", err)
+	}
+	sink, err := newHTTPSink(cfg)
+	if err != nil {
+		t.Fatalf("failed to create http sink: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = sink.Close()
+	})
+	return sink
+}
+
+func TestHTTPSinkPostsSignedEventJSON(t *testing.T) {
+	t.Setenv("FILE_WATCH_TEST_SECRET", "s3cret")
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	sink := newTestHTTPSink(t, &SinkConfig{URL: server.URL, SecretEnv: "FILE_WATCH_TEST_SECRET", Headers: map[string]string{"Authorization": "Bearer arena"}})
+	if _, err := sink.Deliver(t.Context(), sinkPayload); err != nil {
+		t.Fatalf("Deliver returned error: %v", err)
+	}
+
+	req := <-received
+	body := <-bodies
+	if req.Method != http.MethodPost || req.Header.Get("Content-Type") != "application/json" || req.Header.Get("Authorization") != "Bearer arena" {
+		t.Fatalf("unexpected request %s %v", req.Method, req.Header)
+	}
+	if req.Header.Get("Traceparent") == "" {
+		t.Fatalf("expected the trace context as request header, got %v", req.Header)
+	}
+	if string(body) != string(sinkPayload.Body) {
+		t.Fatalf("expected the event JSON as body, got %s", body)
+	}
+
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(req.Header.Get(headerTimestamp) + "."))
+	mac.Write(body)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); req.Header.Get(headerSignature) != want {
+		t.Fatalf("expected signature %s, got %s", want, req.Header.Get(headerSignature))
+	}
+}
+
+func TestHTTPSinkClassifiesStatusCodes(t *testing.T) {
+	for _, tc := range []struct {
+		status    int
+		reason    string
+		permanent bool
+	}{
+		{status: http.StatusOK},
+		{status: http.StatusNoContent},
+		{status: http.StatusUnprocessableEntity, reason: failureWorkerError, permanent: true},
+		{status: http.StatusTooManyRequests, reason: failureWorkerError},
+		{status: http.StatusBadGateway, reason: failureTransport},
+		{status: http.StatusFound, reason: failureUnexpectedResponse},
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			if tc.status == http.StatusFound {
+				w.Header().Set("Location", "/elsewhere")
+			}
+			w.WriteHeader(tc.status)
+		}))
+
+		_, err := newTestHTTPSink(t, &SinkConfig{URL: server.URL}).Deliver(t.Context(), sinkPayload)
+		server.Close()
+		if tc.reason == "" {
+			if err != nil {
+				t.Fatalf("status %d: expected success, got %v", tc.status, err)
+			}
+			continue
+		}
+		if err == nil || failureReason(err) != tc.reason || permanentFailure(err) != tc.permanent {
+			t.Fatalf("status %d: expected %s (permanent %v), got %v", tc.status, tc.reason, tc.permanent, err)
+		}
+	}
+}
+
+func TestHTTPSinkTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	cfg := &Config{Sinks: map[string]*SinkConfig{"importer": {URL: server.URL, Timeout: "50ms"}}}
+	p := &Plugin{cfg: cfg, sinks: map[string]Sink{"importer": newTestHTTPSink(t, cfg.Sinks["importer"])}}
+	_, err := p.executePayload("importer", sinkPayload, cfg.DispatchTimeout("importer"))
+	if err == nil || failureReason(err) != failureTimeout {
+		t.Fatalf("expected a timeout, got %v", err)
+	}
+}
+
+func TestHTTPSinkTimeoutSetsTheDispatchDeadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		time.Sleep(11 * time.Second)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	cfg := &Config{Sinks: map[string]*SinkConfig{"importer": {URL: server.URL, Timeout: "15s"}}}
+	p := &Plugin{cfg: cfg, sinks: map[string]Sink{"importer": newTestHTTPSink(t, cfg.Sinks["importer"])}}
+	if timeout := cfg.DispatchTimeout("importer"); timeout != 15*time.Second {
+		t.Fatalf("expected the sink timeout as dispatch deadline, got %s", timeout)
+	}
+	if timeout := cfg.DispatchTimeout(OutputPool); timeout != defaultDispatchTimeout {
+		t.Fatalf("expected the default dispatch deadline without a timeout, got %s", timeout)
+	}
+
+	if _, err := p.executePayload("importer", sinkPayload, cfg.DispatchTimeout("importer")); err != nil {
+		t.Fatalf("expected a webhook answering within its timeout to succeed, got %v", err)
+	}
+}
+
+func TestHTTPSinkTrustsConfiguredCA(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(ca, certPEM, 0644); err != nil {
+		t.Fatalf("failed to write CA: %v", err)
+	}
+
+	if _, err := newTestHTTPSink(t, &SinkConfig{URL: server.URL}).Deliver(t.Context(), sinkPayload); err == nil {
+		t.Fatal("expected the test certificate to be untrusted by default")
+	}
+	if _, err := newTestHTTPSink(t, &SinkConfig{URL: server.URL, TLS: &SinkTLSConfig{CA: ca}}).Deliver(t.Context(), sinkPayload); err != nil {
+		t.Fatalf("expected the configured CA to be trusted: %v", err)
+	}
+}
+
+func TestConfigRejectsHTTPSinkWithEmptySecret(t *testing.T) {
+	t.Setenv("FILE_WATCH_TEST_SECRET", "")
+	sink := &SinkConfig{Type: OutputHTTP, URL: "https://arena.example.com/import", SecretEnv: "FILE_WATCH_TEST_SECRET"}
+
+	if err := sink.Validate(); err == nil {
+		t.Fatal("expected a secret_env without value to be rejected")
+	}
+}
+
+func TestExecSinkPassesEventOnStdin(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "event.json")
+	sink := newExecSink([]string{"sh", "-c", `cat > "$0" && test -n "$TRACEPARENT"`, out})
+
+	if _, err := sink.Deliver(t.Context(), sinkPayload); err != nil {
+		t.Fatalf("Deliver returned error: %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil || string(data) != string(sinkPayload.Body) {
+		t.Fatalf("expected the event JSON on stdin, got %q (%v)", data, err)
+	}
+}
+
+func TestExecSinkFailsOnNonZeroExit(t *testing.T) {
+	_, err := newExecSink([]string{"sh", "-c", "echo broken >&2; exit 3"}).Deliver(t.Context(), sinkPayload)
+	if err == nil || failureReason(err) != failureWorkerError {
+		t.Fatalf("expected a worker_error failure, got %v", err)
+	}
+}
+
+func TestSocketSinkClassifiesResponseLine(t *testing.T) {
+	for _, tc := range []struct {
+		response string
+		reason   string
+	}{
+		{response: "OK\n"},
+		{response: "ERROR\n", reason: failureWorkerError},
+		{response: "maybe\n", reason: failureUnexpectedResponse},
+		{response: "", reason: failureNoResponse},
+	} {
+		path := filepath.Join(t.TempDir(), "importer.sock")
+		ln, err := net.Listen("unix", path)
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+		lines := make(chan string, 1)
+		go func() {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			line, _ := bufio.NewReader(conn).ReadString('\n')
+			lines <- line
+			_, _ = conn.Write([]byte(tc.response))
+		}()
+
+		_, err = newSocketSink(path).Deliver(t.Context(), sinkPayload)
+		_ = ln.Close()
+		if line := <-lines; line != string(sinkPayload.Body)+"\n" {
+			t.Fatalf("expected the event JSON line, got %q", line)
+		}
+		if tc.reason == "" && err != nil {
+			t.Fatalf("response %q: expected success, got %v", tc.response, err)
+		}
+		if tc.reason != "" && (err == nil || failureReason(err) != tc.reason) {
+			t.Fatalf("response %q: expected %s, got %v", tc.response, tc.reason, err)
+		}
+	}
+}
+
+func TestWatchUsesItsSink(t *testing.T) {
+	cfg := &Config{
+		Output:  OutputPool,
+		Watches: []WatchConfig{{Dir: "./lmx/results", Sink: "importer"}},
+		Sinks:   map[string]*SinkConfig{"importer": {Type: OutputHTTP, URL: "http://127.0.0.1:8080/import"}},
+	}
+	cfg.InitDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected sink config to be valid: %v", err)
+	}
+
+	p := &Plugin{cfg: cfg, sinks: make(map[string]Sink)}
+	for _, name := range cfg.SinkNames() {
+		sinkCfg, _ := cfg.Sink(name)
+		sink, err := p.newSink(sinkCfg)
+		if err != nil {
+			t.Fatalf("failed to create sink %s: %v", name, err)
+		}
+		p.sinks[name] = sink
+	}
+
+	targets := p.newTargets("lmx/results")
+	if _, ok := p.sink(targets[0].name).(*httpSink); !ok || len(targets) != 1 {
+		t.Fatalf("expected the watch to use its http sink, got %v", targets)
+	}
+	targets = p.newTargets("./other")
+	if _, ok := p.sink(targets[0].name).(*poolSink); !ok || len(targets) != 1 {
+		t.Fatalf("expected other directories to use the pool, got %v", targets)
+	}
+}
+
+func TestConfigRejectsUnknownWatchSink(t *testing.T) {
+	cfg := &Config{Watches: []WatchConfig{{Dir: "./lmx/results", Sink: "importer"}}}
+	cfg.InitDefaults()
+
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected a watch with an unknown sink to be rejected")
+	}
+}
+
+func TestConfigRejectsInvalidSinks(t *testing.T) {
+	for name, sink := range map[string]*SinkConfig{
+		"webhook":  {Type: OutputHTTP, URL: "ftp://example.com"},
+		"command":  {Type: OutputExec},
+		"socket":   {Type: OutputSocket},
+		"unknown":  {Type: "smtp"},
+		"pipeline": {Type: OutputJobs, Jobs: &JobsConfig{}},
+	} {
+		cfg := &Config{Sinks: map[string]*SinkConfig{name: sink}}
+		cfg.InitDefaults()
+
+		if err := cfg.Validate(); err == nil {
+			t.Fatalf("expected sink %s to be rejected", name)
+		}
+	}
+}
+
+func TestRejectedWebhookEventIsNotRetried(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "result.game")
+	if err := os.WriteFile(path, []byte("content"), 0644); err != nil {
+		t.Fatalf("failed to write result file: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat result file: %v", err)
+	}
+
+	p := &Plugin{
+		cfg:   &Config{Output: "webhook", MaxAttempts: 3, RetryBackoff: "1h"},
+		log:   zap.NewNop(),
+		sinks: map[string]Sink{"webhook": newTestHTTPSink(t, &SinkConfig{URL: server.URL})},
+	}
+	p.metrics = newStatsExporter(p, nil)
+	pending := make(map[string]*pendingFileEvent)
+	timers := newEventTimers()
+
+	pendingEvent := queueEvent(pending, watcher.Event{Path: path, Op: watcher.Create, FileInfo: info})
+	p.pendingMu.Lock()
+	defer p.pendingMu.Unlock()
+	p.dispatchPendingEvent(pending, timers, pendingEvent)
+
+	if _, ok := pending[path]; ok {
+		t.Fatal("expected an event rejected with 400 not to be retried")
+	}
+	if _, ok := p.deadLetters[path]; !ok {
+		t.Fatal("expected the rejected event to be recorded as dead letter")
+	}
+}
@@ -1,64 +1,174 @@
 package roadrunner
 
 import (
+	"fmt"
+	"maps"
 	"net/http"
+	"path/filepath"
+	"slices"
+	"time"
 
 	"github.com/roadrunner-server/api/v4/plugins/v1/status"
 	"github.com/roadrunner-server/pool/fsm"
 )
 
+// Health checks reported in HealthReason.Check.
+const (
+	healthCheckWorkers   = "workers"
+	healthCheckWatcher   = "watcher"
+	healthCheckDirs      = "dirs"
+	healthCheckStale     = "stale"
+	healthCheckErrorRate = "error_rate"
+	healthCheckCircuit   = "circuit"
+)
+
 // Status return status of the particular plugin
 func (p *Plugin) Status() (*status.Status, error) {
-	p.mu.RLock()
-	defer p.mu.RUnlock()
-
-	// RoadRunner can ask for status before Serve has created the pool, or after
-	// startup failed. In that state the plugin is alive but unavailable.
-	if p.workersPool == nil {
-		return &status.Status{
-			Code: http.StatusServiceUnavailable,
-		}, nil
-	}
-
-	workers := p.workersPool.Workers()
-	for i := 0; i < len(workers); i++ {
-		if workers[i].State().IsActive() {
-			return &status.Status{
-				Code: http.StatusOK,
-			}, nil
-		}
-	}
-	// if there are no workers, treat this as error
 	return &status.Status{
-		Code: http.StatusServiceUnavailable,
+		Code: p.health(false).Code,
 	}, nil
 }
 
 // Ready return readiness status of the particular plugin
 func (p *Plugin) Ready() (*status.Status, error) {
+	return &status.Status{
+		Code: p.health(true).Code,
+	}, nil
+}
+
+// health combines worker state, watcher liveness, directory accessibility,
+// directory staleness, the dispatch error rate and the circuit breakers. With
+// ready set the workers must be ready instead of merely active.
+func (p *Plugin) health(ready bool) *HealthReport {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
-	// RoadRunner can ask for readiness before Serve has created the pool, or after
-	// startup failed. In that state the plugin is alive but not ready.
-	if p.workersPool == nil {
-		return &status.Status{
-			Code: http.StatusServiceUnavailable,
-		}, nil
+	report := &HealthReport{}
+
+	// Without a pool sink no workers of this plugin process events; with jobs the
+	// jobs plugin owns the workers and reports their health.
+	if !p.withoutPool {
+		// RoadRunner can ask for status before Serve has created the pool, or after
+		// startup failed. In that state the plugin is alive but unavailable.
+		if p.workersPool == nil {
+			report.unavailable(healthCheckWorkers, "", "worker pool is not running")
+			report.Code = http.StatusServiceUnavailable
+			return report
+		}
+
+		if !p.workersHealthy(ready) {
+			if ready {
+				report.unavailable(healthCheckWorkers, "", "no worker is ready")
+			} else {
+				report.unavailable(healthCheckWorkers, "", "no worker is active")
+			}
+		}
 	}
+	p.checkWatcher(report, time.Now())
 
+	report.Code = report.code(p.cfg.DegradedStatusCode)
+	return report
+}
+
+// workersHealthy reports whether at least one worker is active, or ready with
+// ready set. The caller must hold mu.
+func (p *Plugin) workersHealthy(ready bool) bool {
 	workers := p.workersPool.Workers()
 	for i := 0; i < len(workers); i++ {
 		// If state of the worker is ready (at least 1)
 		// we assume, that plugin's worker pool is ready
-		if workers[i].State().Compare(fsm.StateReady) {
-			return &status.Status{
-				Code: http.StatusOK,
-			}, nil
+		if ready && workers[i].State().Compare(fsm.StateReady) {
+			return true
+		}
+		if !ready && workers[i].State().IsActive() {
+			return true
 		}
 	}
-	// if there are no workers, treat this as no content error
-	return &status.Status{
-		Code: http.StatusServiceUnavailable,
-	}, nil
+	return false
+}
+
+// checkWatcher adds the failed watcher, directory, error rate and circuit breaker
+// checks to the report. The caller must hold mu.
+func (p *Plugin) checkWatcher(report *HealthReport, now time.Time) {
+	if err := p.watcherErr.Load(); err != nil {
+		report.unavailable(healthCheckWatcher, "", fmt.Sprintf("file watcher stopped: %v", *err))
+	} else if p.watcher == nil {
+		report.unavailable(healthCheckWatcher, "", "file watcher is not running")
+	}
+
+	if len(p.cfg.WatchDirs()) == 0 {
+		report.unavailable(healthCheckDirs, "", "no watch directory is available")
+	}
+	for _, dir := range p.missingDirs {
+		report.degraded(healthCheckDirs, dir, "watch directory does not exist or is not a directory")
+	}
+
+	for _, dir := range p.staleWatchDirs(now) {
+		report.degraded(healthCheckStale, dir, "no file event received within stale_after")
+	}
+
+	ok, failed := p.errorRate.counts(now)
+	if total := ok + failed; total >= p.cfg.ErrorRateMinDispatches && float64(failed)/float64(total) > p.cfg.MaxErrorRate {
+		report.degraded(healthCheckErrorRate, "", fmt.Sprintf("%d of %d dispatches failed within %s", failed, total, p.cfg.ErrorRateWindow))
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(p.breakers)) {
+		if state := p.breakers[name].current(); state != circuitClosed {
+			report.Reasons = append(report.Reasons, HealthReason{Check: healthCheckCircuit, Target: name, Message: fmt.Sprintf("circuit breaker is %s", state), Degraded: true})
+		}
+	}
+}
+
+func (r *HealthReport) unavailable(check, dir, message string) {
+	r.Reasons = append(r.Reasons, HealthReason{Check: check, Dir: dir, Message: message})
+}
+
+func (r *HealthReport) degraded(check, dir, message string) {
+	r.Reasons = append(r.Reasons, HealthReason{Check: check, Dir: dir, Message: message, Degraded: true})
+}
+
+// code returns 503 when any check made the plugin unavailable, degradedCode when
+// checks only degraded it, and 200 otherwise.
+func (r *HealthReport) code(degradedCode int) int {
+	code := http.StatusOK
+	for _, reason := range r.Reasons {
+		if !reason.Degraded {
+			return http.StatusServiceUnavailable
+		}
+		code = degradedCode
+	}
+	return code
+}
+
+// staleWatchDirs returns the configured watch directories with stale_after set
+// that received no file event during their active hours for longer than stale_after.
+// A directory that never received an event counts from when it was first configured.
+// The caller must hold mu.
+func (p *Plugin) staleWatchDirs(now time.Time) []string {
+	var stale []string
+	for _, watch := range p.cfg.Watches {
+		staleAfter, _ := watch.StaleAfterDuration()
+		if staleAfter == 0 {
+			continue
+		}
+		for _, dir := range append(p.cfg.WatchDirs(), p.missingDirs...) {
+			if filepath.Clean(dir) != filepath.Clean(watch.Dir) {
+				continue
+			}
+			since, lastEvent, ok := p.metrics.WatchDirActivity(dir)
+			if !ok {
+				continue
+			}
+			if lastEvent.After(since) {
+				since = lastEvent
+			}
+			// Only silence during active hours counts, and a directory is not
+			// reported while files are not expected.
+			schedule := p.schedules[filepath.Clean(dir)]
+			if schedule.active(now) && schedule.activeBetween(since, now, staleAfter) > staleAfter {
+				stale = append(stale, dir)
+			}
+		}
+	}
+	return stale
 }
@@ -3,6 +3,7 @@ package roadrunner
 import (
 	"net/http"
 	"testing"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -49,3 +50,108 @@ func TestStopIsIdempotent(t *testing.T) {
 		t.Fatalf("second Stop returned error: %v", err)
 	}
 }
+
+func TestStaleWatchDirsHonoursStaleAfter(t *testing.T) {
+	cfg := &Config{
+		Dirs: []string{"./lmx/results"},
+		Watches: []WatchConfig{
+			{Dir: "./lmx/results", StaleAfter: "1h"},
+			{Dir: "./lmx6/results"},
+		},
+	}
+	cfg.InitDefaults()
+	p := &Plugin{cfg: cfg}
+	p.metrics = newStatsExporter(p, cfg)
+	p.metrics.SetWatchDir("./lmx/results", true)
+	p.metrics.SetWatchDir("./lmx6/results", true)
+
+	if stale := p.staleWatchDirs(time.Now()); len(stale) != 0 {
+		t.Fatalf("expected no stale directories right after start, got %#v", stale)
+	}
+
+	stale := p.staleWatchDirs(time.Now().Add(2 * time.Hour))
+	if len(stale) != 1 || stale[0] != "./lmx/results" {
+		t.Fatalf("expected ./lmx/results to be stale, got %#v", stale)
+	}
+
+	p.metrics.CountEvents("./lmx/results", "CREATE")
+	if stale = p.staleWatchDirs(time.Now().Add(30 * time.Minute)); len(stale) != 0 {
+		t.Fatalf("expected an event to reset staleness, got %#v", stale)
+	}
+}
+
+func TestStaleWatchDirsIgnoresSilenceOutsideActiveHours(t *testing.T) {
+	cfg := &Config{Watches: []WatchConfig{{Dir: "./lmx/results", StaleAfter: "1h", ActiveHours: []string{"14:00-23:00"}, Timezone: "UTC"}}}
+	cfg.InitDefaults()
+	schedule, err := cfg.Watches[0].Schedule()
+	if err != nil {
+		t.Fatalf("Schedule returned error: %v", err)
+	}
+	p := &Plugin{cfg: cfg, schedules: map[string]*activeSchedule{"lmx/results": schedule}}
+	p.metrics = newStatsExporter(p, cfg)
+	p.metrics.SetWatchDir("./lmx/results", true)
+
+	since, _, _ := p.metrics.WatchDirActivity("./lmx/results")
+	night := time.Date(since.Year(), since.Month(), since.Day()+1, 3, 0, 0, 0, time.UTC)
+	if stale := p.staleWatchDirs(night); len(stale) != 0 {
+		t.Fatalf("expected no stale directories at night, got %#v", stale)
+	}
+	evening := time.Date(since.Year(), since.Month(), since.Day()+1, 16, 0, 0, 0, time.UTC)
+	if stale := p.staleWatchDirs(evening); len(stale) != 1 {
+		t.Fatalf("expected the directory to be stale after two active hours, got %#v", stale)
+	}
+}
+
+func TestCheckWatcherCombinesWatcherDirsAndErrorRate(t *testing.T) {
+	cfg := &Config{Dirs: []string{"./lmx/results"}, ErrorRateMinDispatches: 2}
+	cfg.InitDefaults()
+	p := &Plugin{cfg: cfg, missingDirs: []string{"./lmx6/results"}, errorRate: newErrorRate(time.Minute)}
+	p.metrics = newStatsExporter(p, cfg)
+
+	now := time.Now()
+	p.errorRate.record(now, true)
+	p.errorRate.record(now, false)
+	p.errorRate.record(now, true)
+
+	report := &HealthReport{}
+	p.checkWatcher(report, now)
+	checks := make(map[string]bool)
+	for _, reason := range report.Reasons {
+		checks[reason.Check] = reason.Degraded
+	}
+	if degraded, ok := checks[healthCheckWatcher]; !ok || degraded {
+		t.Fatalf("expected a stopped watcher to make the plugin unavailable, got %#v", report.Reasons)
+	}
+	if degraded, ok := checks[healthCheckDirs]; !ok || !degraded {
+		t.Fatalf("expected a missing directory to degrade the plugin, got %#v", report.Reasons)
+	}
+	if degraded, ok := checks[healthCheckErrorRate]; !ok || !degraded {
+		t.Fatalf("expected the error rate to degrade the plugin, got %#v", report.Reasons)
+	}
+	if code := report.code(cfg.DegradedStatusCode); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status %d, got %d", http.StatusServiceUnavailable, code)
+	}
+}
+
+func TestDegradedStatusCodeDefaultsToMultiStatus(t *testing.T) {
+	cfg := &Config{Dir: t.TempDir()}
+	cfg.InitDefaults()
+
+	report := &HealthReport{}
+	report.degraded(healthCheckStale, "./lmx/results", "no file event received within stale_after")
+	if code := report.code(cfg.DegradedStatusCode); code != http.StatusMultiStatus {
+		t.Fatalf("expected a degraded plugin to report %d by default, got %d", http.StatusMultiStatus, code)
+	}
+}
+
+func TestHealthReportCodeUsesDegradedStatusCode(t *testing.T) {
+	report := &HealthReport{}
+	if code := report.code(http.StatusMultiStatus); code != http.StatusOK {
+		t.Fatalf("expected status %d without reasons, got %d", http.StatusOK, code)
+	}
+
+	report.degraded(healthCheckStale, "./lmx/results", "no file event received within stale_after")
+	if code := report.code(http.StatusMultiStatus); code != http.StatusMultiStatus {
+		t.Fatalf("expected status %d, got %d", http.StatusMultiStatus, code)
+	}
+}
@@ -0,0 +1,102 @@
+package roadrunner
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/radovskyb/watcher"
+)
+
+// targetState is the delivery state of one target sink of a pending event. Every
+// target keeps its own attempts, so a target that succeeded is not delivered again
+// while another one is retried.
+type targetState struct {
+	name string
+	// attempt counts failed deliveries to the target.
+	attempt int
+	// done is set once the target succeeded or was given up.
+	done bool
+	// err is the error of the last delivery, nil after a success.
+	err error
+}
+
+// newTargets returns fresh delivery state for the targets of the watched directory dir.
+func (p *Plugin) newTargets(dir string) []*targetState {
+	watch := p.cfg.Watch(dir)
+	names := watch.TargetNames(p.cfg.Output)
+	targets := make([]*targetState, len(names))
+	for i, name := range names {
+		targets[i] = &targetState{name: name}
+	}
+	return targets
+}
+
+// deliverTargets delivers the event to every target that is not done yet, all at
+// the same time. A target is given up after max_attempts failed deliveries or a
+// permanent failure.
+func (p *Plugin) deliverTargets(ctx context.Context, event watcher.Event, dir string, targets []*targetState) {
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		if target.done {
+			continue
+		}
+		wg.Go(func() {
+			p.settleTarget(dir, target, p.dispatchEvent(ctx, event, target.name, target.attempt+1))
+		})
+	}
+	wg.Wait()
+}
+
+// settleTarget records the outcome of a delivery to target.
+func (p *Plugin) settleTarget(dir string, target *targetState, err error) {
+	target.err = err
+	if err == nil {
+		target.done = true
+		return
+	}
+	target.attempt++
+	if target.attempt >= p.cfg.MaxAttempts || permanentFailure(err) {
+		target.done = true
+		p.metrics.CountTargetGivenUp(dir, target.name)
+	}
+}
+
+// targetsDone reports whether every target succeeded or was given up.
+func targetsDone(targets []*targetState) bool {
+	for _, target := range targets {
+		if !target.done {
+			return false
+		}
+	}
+	return true
+}
+
+// targetsOutcome returns nil when the event counts as delivered under success,
+// otherwise the error of the first failed target that matters.
+func targetsOutcome(success string, targets []*targetState) error {
+	if success == SuccessPrimary {
+		return targetError(targets, targets[0])
+	}
+	var failed *targetState
+	for _, target := range targets {
+		if target.err == nil && success == SuccessAny {
+			return nil
+		}
+		if target.err != nil && failed == nil {
+			failed = target
+		}
+	}
+	if failed == nil {
+		return nil
+	}
+	return targetError(targets, failed)
+}
+
+// targetError names the failed target when an event has several.
+func targetError(targets []*targetState, target *targetState) error {
+	if target.err == nil || len(targets) == 1 {
+		return target.err
+	}
+	return fmt.Errorf("target %s: %w", target.name, target.err)
+}
@@ -0,0 +1,138 @@
+package roadrunner
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/radovskyb/watcher"
+	"go.uber.org/zap"
+)
+
+func TestTargetsOutcomeFollowsSuccessSemantics(t *testing.T) {
+	failed := errors.New("webhook failed")
+	importerFailed := []*targetState{{name: "importer", done: true, err: failed}, {name: "warmer", done: true}}
+	warmerFailed := []*targetState{{name: "importer", done: true}, {name: "warmer", done: true, err: failed}}
+	bothFailed := []*targetState{{name: "importer", done: true, err: failed}, {name: "warmer", done: true, err: failed}}
+
+	for _, tc := range []struct {
+		success string
+		targets []*targetState
+		ok      bool
+	}{
+		{success: SuccessAll, targets: warmerFailed, ok: false},
+		{success: SuccessAny, targets: warmerFailed, ok: true},
+		{success: SuccessAny, targets: importerFailed, ok: true},
+		{success: SuccessAny, targets: bothFailed, ok: false},
+		{success: SuccessPrimary, targets: warmerFailed, ok: true},
+		{success: SuccessPrimary, targets: importerFailed, ok: false},
+	} {
+		err := targetsOutcome(tc.success, tc.targets)
+		if (err == nil) != tc.ok {
+			t.Fatalf("%s: expected delivered %v, got %v", tc.success, tc.ok, err)
+		}
+		if err != nil && !errors.Is(err, failed) {
+			t.Fatalf("%s: expected the target error to be wrapped, got %v", tc.success, err)
+		}
+	}
+}
+
+func TestFanOutRetriesOnlyFailedTargets(t *testing.T) {
+	var importerCalls, warmerCalls atomic.Int32
+	importer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		importerCalls.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer importer.Close()
+	warmer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		// The cache warmer is down for the first attempt only.
+		if warmerCalls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer warmer.Close()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "result.game")
+	if err := os.WriteFile(path, []byte("content"), 0644); err != nil {
+		t.Fatalf("failed to write result file: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat result file: %v", err)
+	}
+
+	cfg := &Config{
+		Dirs:         []string{dir},
+		MaxAttempts:  3,
+		RetryBackoff: "1h",
+		Watches:      []WatchConfig{{Dir: dir, Targets: []string{"importer", "warmer"}}},
+		Sinks: map[string]*SinkConfig{
+			"importer": {Type: OutputHTTP, URL: importer.URL},
+			"warmer":   {Type: OutputHTTP, URL: warmer.URL},
+		},
+	}
+	cfg.InitDefaults()
+	if err = cfg.Validate(); err != nil {
+		t.Fatalf("expected fan-out config to be valid: %v", err)
+	}
+	p := &Plugin{
+		cfg: cfg,
+		log: zap.NewNop(),
+		sinks: map[string]Sink{
+			"importer": newTestHTTPSink(t, cfg.Sinks["importer"]),
+			"warmer":   newTestHTTPSink(t, cfg.Sinks["warmer"]),
+		},
+	}
+	p.metrics = newStatsExporter(p, nil)
+	pending := make(map[string]*pendingFileEvent)
+	timers := newEventTimers()
+
+	pendingEvent := queueEvent(pending, watcher.Event{Path: path, Op: watcher.Create, FileInfo: info})
+	p.pendingMu.Lock()
+	defer p.pendingMu.Unlock()
+	p.dispatchPendingEvent(pending, timers, pendingEvent)
+
+	retry, ok := pending[path]
+	if !ok {
+		t.Fatal("expected the event to be retried for the failed target")
+	}
+	p.dispatchPendingEvent(pending, timers, retry)
+
+	if _, ok = pending[path]; ok {
+		t.Fatal("expected the event to be done once every target succeeded")
+	}
+	if importerCalls.Load() != 1 || warmerCalls.Load() != 2 {
+		t.Fatalf("expected 1 importer and 2 warmer deliveries, got %d and %d", importerCalls.Load(), warmerCalls.Load())
+	}
+	if _, ok = p.deadLetters[path]; ok {
+		t.Fatal("expected the delivered event not to be a dead letter")
+	}
+	// Each attempt counts once in the job metrics, however many targets it had.
+	if ok, failed := atomic.LoadUint64(p.metrics.jobsOk), atomic.LoadUint64(p.metrics.jobsErr); ok != 1 || failed != 1 {
+		t.Fatalf("expected one failed and one successful attempt, got %d and %d", failed, ok)
+	}
+}
+
+func TestConfigRejectsInvalidTargets(t *testing.T) {
+	sinks := map[string]*SinkConfig{"importer": {Type: OutputHTTP, URL: "https://arena.example.com/import"}}
+	for name, watch := range map[string]WatchConfig{
+		"sink and targets": {Dir: "./lmx/results", Sink: "importer", Targets: []string{"importer", OutputPool}},
+		"duplicate target": {Dir: "./lmx/results", Targets: []string{"importer", "importer"}},
+		"unknown target":   {Dir: "./lmx/results", Targets: []string{"importer", "warmer"}},
+		"unknown success":  {Dir: "./lmx/results", Targets: []string{"importer", OutputPool}, Success: "most"},
+	} {
+		cfg := &Config{Watches: []WatchConfig{watch}, Sinks: sinks}
+		cfg.InitDefaults()
+
+		if err := cfg.Validate(); err == nil {
+			t.Fatalf("expected %s to be rejected", name)
+		}
+	}
+}
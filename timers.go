@@ -0,0 +1,127 @@
+package roadrunner
+
+import (
+	"container/heap"
+	"time"
+)
+
+// eventTimers holds the debounce and retry timers of the pending events in one
+// heap ordered by fire time, with a single runtime timer for the earliest entry.
+// The event loop selects on C and takes the due events itself, so a timer needs
+// neither a goroutine nor room in a channel when it fires. It is owned by the
+// event loop and guarded by pendingMu.
+type eventTimers struct {
+	entries timerHeap
+	// byPath holds the entry of every path, so scheduling an event again moves its
+	// entry instead of adding another one.
+	byPath map[string]*timerEntry
+	timer  *time.Timer
+	// C receives a value when the earliest entry is due.
+	C <-chan time.Time
+}
+
+// timerEntry is the timer of the event for path. seq is the seq of the event when
+// it was scheduled; a later change of the event leaves the entry stale.
+type timerEntry struct {
+	path  string
+	seq   uint64
+	at    time.Time
+	index int
+}
+
+// timerHeap implements heap.Interface, earliest entry first.
+type timerHeap []*timerEntry
+
+func (h timerHeap) Len() int { return len(h) }
+
+func (h timerHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+
+func (h timerHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *timerHeap) Push(x any) {
+	entry := x.(*timerEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *timerHeap) Pop() any {
+	old := *h
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return entry
+}
+
+func newEventTimers() *eventTimers {
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	return &eventTimers{byPath: make(map[string]*timerEntry), timer: timer, C: timer.C}
+}
+
+// schedule sets the timer of path to at, replacing the one it had.
+func (t *eventTimers) schedule(path string, seq uint64, at time.Time) {
+	if entry, ok := t.byPath[path]; ok {
+		entry.seq = seq
+		entry.at = at
+		heap.Fix(&t.entries, entry.index)
+	} else {
+		entry = &timerEntry{path: path, seq: seq, at: at}
+		heap.Push(&t.entries, entry)
+		t.byPath[path] = entry
+	}
+	t.arm(time.Now())
+}
+
+// due removes the entries that are due at now and returns them, earliest first.
+// The runtime timer is set for the next entry.
+func (t *eventTimers) due(now time.Time) []debouncedFileEvent {
+	var due []debouncedFileEvent
+	for len(t.entries) > 0 && !t.entries[0].at.After(now) {
+		entry := heap.Pop(&t.entries).(*timerEntry)
+		delete(t.byPath, entry.path)
+		due = append(due, debouncedFileEvent{path: entry.path, seq: entry.seq})
+	}
+	t.arm(now)
+	return due
+}
+
+// overdue counts the entries of pending events that are due at now but were not
+// taken by the event loop yet.
+func (t *eventTimers) overdue(pending map[string]*pendingFileEvent, now time.Time) int {
+	var count int
+	// Children fire after their parent, so only due subtrees are visited.
+	var visit func(i int)
+	visit = func(i int) {
+		if i >= len(t.entries) || t.entries[i].at.After(now) {
+			return
+		}
+		entry := t.entries[i]
+		if current, ok := pending[entry.path]; ok && current.seq == entry.seq {
+			count++
+		}
+		visit(2*i + 1)
+		visit(2*i + 2)
+	}
+	visit(0)
+	return count
+}
+
+// arm sets the runtime timer for the earliest entry.
+func (t *eventTimers) arm(now time.Time) {
+	if len(t.entries) == 0 {
+		t.timer.Stop()
+		return
+	}
+	t.timer.Reset(t.entries[0].at.Sub(now))
+}
+
+// stop removes every entry when the event loop stops.
+func (t *eventTimers) stop() {
+	t.timer.Stop()
+	t.entries = nil
+	clear(t.byPath)
+}
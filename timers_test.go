@@ -0,0 +1,57 @@
+package roadrunner
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventTimersFireEarliestFirst(t *testing.T) {
+	now := time.Now()
+	timers := newEventTimers()
+	defer timers.stop()
+
+	timers.schedule("late.game", 1, now.Add(time.Hour))
+	timers.schedule("soon.game", 1, now.Add(time.Minute))
+	timers.schedule("first.game", 1, now.Add(-time.Second))
+	// Scheduling a path again moves its entry instead of adding one.
+	timers.schedule("late.game", 2, now.Add(-2*time.Second))
+	if len(timers.entries) != 3 {
+		t.Fatalf("expected one entry per path, got %d", len(timers.entries))
+	}
+
+	pending := map[string]*pendingFileEvent{
+		"late.game":  {seq: 2},
+		"first.game": {seq: 3},
+	}
+	if overdue := timers.overdue(pending, now); overdue != 1 {
+		t.Fatalf("expected only the current due entry to be overdue, got %d", overdue)
+	}
+
+	due := timers.due(now)
+	if len(due) != 2 || due[0] != (debouncedFileEvent{path: "late.game", seq: 2}) || due[1].path != "first.game" {
+		t.Fatalf("expected the due entries earliest first, got %+v", due)
+	}
+	if len(timers.entries) != 1 || timers.entries[0].path != "soon.game" {
+		t.Fatalf("expected soon.game to be left, got %d entries", len(timers.entries))
+	}
+	if due = timers.due(now.Add(time.Minute)); len(due) != 1 || due[0].path != "soon.game" {
+		t.Fatalf("expected soon.game to be due a minute later, got %+v", due)
+	}
+}
+
+func TestEventTimersSignalWhenDue(t *testing.T) {
+	timers := newEventTimers()
+	defer timers.stop()
+
+	timers.schedule("result.game", 1, time.Now().Add(time.Hour))
+	timers.schedule("result.game", 2, time.Now().Add(10*time.Millisecond))
+
+	select {
+	case <-timers.C:
+	case <-time.After(time.Second):
+		t.Fatal("expected the timer to follow the rescheduled entry")
+	}
+	if due := timers.due(time.Now()); len(due) != 1 || due[0].seq != 2 {
+		t.Fatalf("expected the rescheduled entry, got %+v", due)
+	}
+}
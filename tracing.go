@@ -0,0 +1,103 @@
+package roadrunner
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/radovskyb/watcher"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/LaserLiga/rr_file_watch"
+
+// Span names of a traced file event. The event span covers the whole life of a
+// pending event; debounce, dispatch and worker_exec spans are its children. A
+// batch_dispatch span starts its own trace and links the spans of its events.
+const (
+	spanEvent      = "file_watch.event"
+	spanDebounce   = "file_watch.debounce"
+	spanDispatch   = "file_watch.dispatch"
+	spanWorkerExec = "file_watch.worker_exec"
+	spanBatch      = "file_watch.batch_dispatch"
+)
+
+// tracePropagator writes W3C trace context into the payload context, so worker
+// spans join the trace of the file event.
+var tracePropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// tracer returns the tracer of the global tracer provider. RoadRunner's OpenTelemetry
+// plugin registers its provider globally; without it spans are not recorded.
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+func eventAttributes(dir string, event watcher.Event) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("file_watch.dir", dir),
+		attribute.String("file_watch.path", event.Path),
+		attribute.String("file_watch.op", opName(event.Op)),
+	}
+	if event.FileInfo != nil {
+		attrs = append(attrs, attribute.Int64("file_watch.size", event.Size()))
+	}
+	if isRenameEvent(event) {
+		attrs = append(attrs, attribute.String("file_watch.old_path", event.OldPath))
+	}
+	return attrs
+}
+
+// startEventSpan starts the event span at detection time and records the
+// debounce wait as its first child. Later attempts reuse the event span.
+func (p *Plugin) startEventSpan(pendingEvent *pendingFileEvent) {
+	if pendingEvent.span != nil {
+		return
+	}
+
+	attrs := eventAttributes(p.watchedDirectoryForEvent(pendingEvent.event.Path), pendingEvent.event)
+	ctx, span := tracer().Start(context.Background(), spanEvent, trace.WithTimestamp(pendingEvent.detected), trace.WithAttributes(attrs...))
+	_, debounce := tracer().Start(ctx, spanDebounce, trace.WithTimestamp(pendingEvent.detected))
+	debounce.End()
+
+	pendingEvent.ctx = ctx
+	pendingEvent.span = span
+}
+
+// endSpan ends the event span of a pending event that is done, failed for good
+// or discarded. It does nothing when no span was started.
+func (e *pendingFileEvent) endSpan(err error) {
+	if e.span == nil {
+		return
+	}
+	e.span.SetAttributes(attribute.Int("file_watch.attempts", e.attempt+1))
+	endSpan(e.span, err)
+	e.span = nil
+	e.ctx = nil
+}
+
+// traceContext returns the W3C trace context of ctx as the JSON payload context,
+// or nil when ctx carries no recorded span.
+func traceContext(ctx context.Context) []byte {
+	carrier := propagation.MapCarrier{}
+	tracePropagator.Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(carrier)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// endSpan ends a span, marking it failed when err is set.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,89 @@
+package roadrunner
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/radovskyb/watcher"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+	"go.uber.org/zap"
+)
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+	})
+	return recorder
+}
+
+func TestDispatchPendingEventTracesEveryAttempt(t *testing.T) {
+	recorder := recordSpans(t)
+
+	path := filepath.Join(t.TempDir(), "result.game")
+	if err := os.WriteFile(path, []byte("content"), 0644); err != nil {
+		t.Fatalf("failed to write result file: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat result file: %v", err)
+	}
+
+	// Without a worker pool every dispatch fails.
+	p := &Plugin{cfg: &Config{MaxAttempts: 2, RetryBackoff: "1h"}, log: zap.NewNop()}
+	p.metrics = newStatsExporter(p, nil)
+	pending := make(map[string]*pendingFileEvent)
+	timers := newEventTimers()
+
+	pendingEvent := queueEvent(pending, watcher.Event{Path: path, Op: watcher.Create, FileInfo: info})
+	p.pendingMu.Lock()
+	defer p.pendingMu.Unlock()
+	p.dispatchPendingEvent(pending, timers, pendingEvent)
+	p.dispatchPendingEvent(pending, timers, pending[path])
+
+	counts := make(map[string]int)
+	var event sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		counts[span.Name()]++
+		if span.Name() == spanEvent {
+			event = span
+		}
+	}
+	if counts[spanEvent] != 1 || counts[spanDebounce] != 1 || counts[spanDispatch] != 2 || counts[spanWorkerExec] != 2 {
+		t.Fatalf("unexpected spans %#v", counts)
+	}
+	if event.Status().Code != codes.Error {
+		t.Fatalf("expected the event span to record the failure, got %v", event.Status())
+	}
+	for _, span := range recorder.Ended() {
+		if span.SpanContext().TraceID() != event.SpanContext().TraceID() {
+			t.Fatalf("expected %s to join the event trace", span.Name())
+		}
+	}
+}
+
+func TestTraceContextCarriesW3CTraceParent(t *testing.T) {
+	recordSpans(t)
+
+	if data := traceContext(t.Context()); data != nil {
+		t.Fatalf("expected no trace context without a span, got %s", data)
+	}
+
+	ctx, span := tracer().Start(t.Context(), spanWorkerExec)
+	defer span.End()
+
+	var carrier map[string]string
+	if err := json.Unmarshal(traceContext(ctx), &carrier); err != nil {
+		t.Fatalf("expected JSON trace context: %v", err)
+	}
+	if carrier["traceparent"] == "" {
+		t.Fatalf("expected a traceparent header, got %#v", carrier)
+	}
+}
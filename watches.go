@@ -0,0 +1,272 @@
+package roadrunner
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/roadrunner-server/errors"
+	"go.uber.org/zap"
+)
+
+// watchState holds runtime watch directory changes that were explicitly persisted.
+// It is stored as JSON in Config.StateFile and applied on top of the configured
+// directories on the next Serve.
+type watchState struct {
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+func loadWatchState(path string) (*watchState, error) {
+	state := &watchState{}
+	if path == "" {
+		return state, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func (s *watchState) save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated state file.
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *watchState) add(dir string) {
+	s.Removed = slices.DeleteFunc(s.Removed, func(d string) bool { return d == dir })
+	if !slices.Contains(s.Added, dir) {
+		s.Added = append(s.Added, dir)
+	}
+}
+
+func (s *watchState) remove(dir string) {
+	s.Added = slices.DeleteFunc(s.Added, func(d string) bool { return d == dir })
+	if !slices.Contains(s.Removed, dir) {
+		s.Removed = append(s.Removed, dir)
+	}
+}
+
+// apply returns the configured directories with the persisted changes applied.
+func (s *watchState) apply(dirs []string) []string {
+	result := make([]string, 0, len(dirs)+len(s.Added))
+	for _, dir := range dirs {
+		if !slices.Contains(s.Removed, filepath.Clean(dir)) {
+			result = append(result, dir)
+		}
+	}
+	for _, dir := range s.Added {
+		if !containsDir(result, dir) {
+			result = append(result, dir)
+		}
+	}
+	return result
+}
+
+func containsDir(dirs []string, dir string) bool {
+	return slices.ContainsFunc(dirs, func(d string) bool { return filepath.Clean(d) == dir })
+}
+
+// addWatch starts watching dir on the live watcher.
+func (p *Plugin) addWatch(dir string, persist bool) error {
+	const op = errors.Op("file_watch_add_watch")
+	if dir == "" {
+		return errors.E(op, errors.Str("directory is required"))
+	}
+	dir = filepath.Clean(dir)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.watcher == nil {
+		return errors.E(op, errors.Str("file watcher is not running"))
+	}
+	if persist && p.cfg.StateFile == "" {
+		return errors.E(op, errors.Str("state_file is not configured"))
+	}
+	if containsDir(p.cfg.WatchDirs(), dir) {
+		return errors.E(op, errors.Errorf("directory %q is already watched", dir))
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return errors.E(op, err)
+	}
+	if !info.IsDir() {
+		return errors.E(op, errors.Errorf("%q is not a directory", dir))
+	}
+
+	if err = p.watcher.Add(dir); err != nil {
+		return errors.E(op, err)
+	}
+	p.cfg.Dirs = append(p.cfg.Dirs, dir)
+	p.missingDirs = slices.DeleteFunc(p.missingDirs, func(d string) bool { return filepath.Clean(d) == dir })
+	p.metrics.SetWatchDir(dir, true)
+
+	if persist {
+		p.watchState.add(dir)
+		if err = p.watchState.save(p.cfg.StateFile); err != nil {
+			return errors.E(op, err)
+		}
+	}
+
+	p.log.Info("watch directory added", zap.String("dir", dir), zap.Bool("persist", persist))
+	return nil
+}
+
+// removeWatch stops watching dir on the live watcher.
+func (p *Plugin) removeWatch(dir string, persist bool) error {
+	const op = errors.Op("file_watch_remove_watch")
+	if dir == "" {
+		return errors.E(op, errors.Str("directory is required"))
+	}
+	dir = filepath.Clean(dir)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.watcher == nil {
+		return errors.E(op, errors.Str("file watcher is not running"))
+	}
+	if persist && p.cfg.StateFile == "" {
+		return errors.E(op, errors.Str("state_file is not configured"))
+	}
+
+	sameDir := func(d string) bool { return filepath.Clean(d) == dir }
+	switch idx := slices.IndexFunc(p.cfg.Dirs, sameDir); {
+	case idx >= 0:
+		if err := p.watcher.Remove(p.cfg.Dirs[idx]); err != nil {
+			return errors.E(op, err)
+		}
+		p.metrics.RemoveWatchDir(p.cfg.Dirs[idx])
+		p.cfg.Dirs = slices.Delete(p.cfg.Dirs, idx, idx+1)
+	case slices.ContainsFunc(p.missingDirs, sameDir):
+		// Configured but not present on disk yet, so only stop waiting for it.
+		idx = slices.IndexFunc(p.missingDirs, sameDir)
+		p.metrics.RemoveWatchDir(p.missingDirs[idx])
+		p.missingDirs = slices.Delete(p.missingDirs, idx, idx+1)
+	default:
+		return errors.E(op, errors.Errorf("directory %q is not watched", dir))
+	}
+
+	if persist {
+		p.watchState.remove(dir)
+		if err := p.watchState.save(p.cfg.StateFile); err != nil {
+			return errors.E(op, err)
+		}
+	}
+
+	p.log.Info("watch directory removed", zap.String("dir", dir), zap.Bool("persist", persist))
+	return nil
+}
+
+// listWatches returns the directories currently watched and the configured
+// directories that are waiting to appear.
+func (p *Plugin) listWatches() (watched []string, missing []string) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.cfg.WatchDirs(), slices.Clone(p.missingDirs)
+}
+
+// watchDirChecks re-checks the watch directories every interval until stopCh is closed.
+func (p *Plugin) watchDirChecks(interval time.Duration, stopCh <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			p.checkWatchDirs()
+		}
+	}
+}
+
+// checkWatchDirs starts watching missing directories that have appeared and
+// moves watched directories that have disappeared back to the missing list.
+func (p *Plugin) checkWatchDirs() {
+	p.mu.RLock()
+	watched := slices.Clone(p.cfg.Dirs)
+	missing := slices.Clone(p.missingDirs)
+	p.mu.RUnlock()
+
+	// Stat without holding the lock, a slow network share must not block dispatch.
+	var appeared, vanished []string
+	for _, dir := range missing {
+		if isDir(dir) {
+			appeared = append(appeared, dir)
+		}
+	}
+	for _, dir := range watched {
+		if !isDir(dir) {
+			vanished = append(vanished, dir)
+		}
+	}
+	if len(appeared) == 0 && len(vanished) == 0 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.watcher == nil {
+		return
+	}
+
+	for _, dir := range vanished {
+		// The directory could have been removed through RPC in the meantime.
+		idx := slices.Index(p.cfg.Dirs, dir)
+		if idx < 0 {
+			continue
+		}
+		if err := p.watcher.Remove(dir); err != nil {
+			p.log.Warn("failed to stop watching a directory that disappeared", zap.String("dir", dir), zap.Error(err))
+		}
+		p.cfg.Dirs = slices.Delete(p.cfg.Dirs, idx, idx+1)
+		p.missingDirs = append(p.missingDirs, dir)
+		p.metrics.SetWatchDir(dir, false)
+		p.log.Warn("watch directory disappeared, waiting for it to come back", zap.String("dir", dir))
+		p.publish(&BusEvent{Kind: EventDirectoryLost, Dir: dir})
+	}
+
+	for _, dir := range appeared {
+		idx := slices.Index(p.missingDirs, dir)
+		if idx < 0 {
+			continue
+		}
+		if err := p.watcher.Add(dir); err != nil {
+			p.log.Warn("failed to watch a directory that appeared", zap.String("dir", dir), zap.Error(err))
+			continue
+		}
+		p.missingDirs = slices.Delete(p.missingDirs, idx, idx+1)
+		p.cfg.Dirs = append(p.cfg.Dirs, dir)
+		p.metrics.SetWatchDir(dir, true)
+		p.log.Info("watch directory appeared, watching it now", zap.String("dir", dir))
+	}
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
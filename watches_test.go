@@ -0,0 +1,150 @@
+package roadrunner
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/radovskyb/watcher"
+	"go.uber.org/zap"
+)
+
+func TestWatchStateApplyAddsAndRemovesDirs(t *testing.T) {
+	state := &watchState{}
+	state.add("./lmx6/results")
+	state.remove("lmx/results")
+
+	dirs := state.apply([]string{"./lmx/results", "./evo5/results"})
+	if !slices.Equal(dirs, []string{"./evo5/results", "./lmx6/results"}) {
+		t.Fatalf("unexpected watch dirs %#v", dirs)
+	}
+}
+
+func TestWatchStateRemoveCancelsEarlierAdd(t *testing.T) {
+	state := &watchState{}
+	state.add("lmx6/results")
+	state.remove("lmx6/results")
+
+	if len(state.Added) != 0 {
+		t.Fatalf("expected added dir to be forgotten, got %#v", state.Added)
+	}
+	if dirs := state.apply([]string{"./lmx/results"}); !slices.Equal(dirs, []string{"./lmx/results"}) {
+		t.Fatalf("unexpected watch dirs %#v", dirs)
+	}
+}
+
+func TestLoadWatchStateMissingFileIsEmpty(t *testing.T) {
+	state, err := loadWatchState(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil {
+		t.Fatalf("expected missing state file to be ignored, got %v", err)
+	}
+	if len(state.Added) != 0 || len(state.Removed) != 0 {
+		t.Fatalf("expected empty state, got %#v", state)
+	}
+}
+
+func TestAddAndRemoveWatchUpdateLiveWatcher(t *testing.T) {
+	tempDir := t.TempDir()
+	configured := filepath.Join(tempDir, "lmx")
+	added := filepath.Join(tempDir, "lmx6")
+	for _, dir := range []string{configured, added} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("failed to create watch dir: %v", err)
+		}
+	}
+
+	w := watcher.New()
+	if err := w.Add(configured); err != nil {
+		t.Fatalf("failed to watch configured dir: %v", err)
+	}
+	stateFile := filepath.Join(tempDir, "state.json")
+	p := &Plugin{
+		cfg:        &Config{Dirs: []string{configured}, StateFile: stateFile},
+		log:        zap.NewNop(),
+		watcher:    w,
+		watchState: &watchState{},
+	}
+	p.metrics = newStatsExporter(p, nil)
+
+	if err := p.addWatch(added, false); err != nil {
+		t.Fatalf("addWatch returned error: %v", err)
+	}
+	if watched, _ := p.listWatches(); !slices.Equal(watched, []string{configured, added}) {
+		t.Fatalf("unexpected watch dirs %#v", watched)
+	}
+	if err := p.addWatch(added, false); err == nil {
+		t.Fatal("expected adding an already watched dir to fail")
+	}
+	if _, err := os.Stat(stateFile); !os.IsNotExist(err) {
+		t.Fatal("expected state file not to be written without persist")
+	}
+
+	if err := p.removeWatch(configured, true); err != nil {
+		t.Fatalf("removeWatch returned error: %v", err)
+	}
+	if watched, _ := p.listWatches(); !slices.Equal(watched, []string{added}) {
+		t.Fatalf("unexpected watch dirs %#v", watched)
+	}
+
+	state, err := loadWatchState(stateFile)
+	if err != nil {
+		t.Fatalf("failed to load persisted state: %v", err)
+	}
+	if !slices.Equal(state.Removed, []string{configured}) || len(state.Added) != 0 {
+		t.Fatalf("unexpected persisted state %#v", state)
+	}
+}
+
+func TestAddWatchRequiresRunningWatcher(t *testing.T) {
+	p := &Plugin{cfg: &Config{}, log: zap.NewNop()}
+
+	if err := p.addWatch(t.TempDir(), false); err == nil {
+		t.Fatal("expected addWatch to fail without a running watcher")
+	}
+}
+
+func TestCheckWatchDirsPicksUpLateDirectoryAndDropsVanishedOne(t *testing.T) {
+	tempDir := t.TempDir()
+	vanishing := filepath.Join(tempDir, "lmx")
+	late := filepath.Join(tempDir, "share")
+	if err := os.Mkdir(vanishing, 0755); err != nil {
+		t.Fatalf("failed to create watch dir: %v", err)
+	}
+
+	w := watcher.New()
+	if err := w.Add(vanishing); err != nil {
+		t.Fatalf("failed to watch dir: %v", err)
+	}
+	p := &Plugin{
+		cfg:         &Config{Dirs: []string{vanishing}},
+		log:         zap.NewNop(),
+		watcher:     w,
+		missingDirs: []string{late},
+	}
+	p.metrics = newStatsExporter(p, nil)
+
+	p.checkWatchDirs()
+	if watched, missing := p.listWatches(); !slices.Equal(watched, []string{vanishing}) || !slices.Equal(missing, []string{late}) {
+		t.Fatalf("expected nothing to change, got watched %#v missing %#v", watched, missing)
+	}
+
+	if err := os.Mkdir(late, 0755); err != nil {
+		t.Fatalf("failed to create late dir: %v", err)
+	}
+	if err := os.Remove(vanishing); err != nil {
+		t.Fatalf("failed to remove watch dir: %v", err)
+	}
+
+	p.checkWatchDirs()
+	watched, missing := p.listWatches()
+	if !slices.Equal(watched, []string{late}) {
+		t.Fatalf("expected late dir to be watched, got %#v", watched)
+	}
+	if !slices.Equal(missing, []string{vanishing}) {
+		t.Fatalf("expected vanished dir to be missing, got %#v", missing)
+	}
+	if _, ok := w.WatchedFiles()[late]; !ok {
+		t.Fatal("expected late dir to be added to the watcher")
+	}
+}